@@ -1,6 +1,9 @@
 package async
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // RunAtLeast ensures the execution time is greater than the duration
 //
@@ -40,3 +43,39 @@ func RunFailedAtLeast(dur time.Duration, f func() error) func() error {
 		return
 	}
 }
+
+// RunAtLeastContext is identical to RunAtLeast, but waiting is aborted when ctx
+// is done
+//
+// It returns ctx.Err() if waiting is aborted, unless f returns an error.
+func RunAtLeastContext(dur time.Duration, f func(context.Context) error) func(context.Context) error {
+	return runAtLeastContext(dur, f, func(error) bool { return true })
+}
+
+// RunSuccessAtLeastContext is identical to RunAtLeastContext, but only
+// successful call counts
+func RunSuccessAtLeastContext(dur time.Duration, f func(context.Context) error) func(context.Context) error {
+	return runAtLeastContext(dur, f, func(err error) bool { return err == nil })
+}
+
+// RunFailedAtLeastContext is identical to RunAtLeastContext, but only failed
+// call counts
+func RunFailedAtLeastContext(dur time.Duration, f func(context.Context) error) func(context.Context) error {
+	return runAtLeastContext(dur, f, func(err error) bool { return err != nil })
+}
+
+// runAtLeastContext waits after calling f if counts(err) is true
+func runAtLeastContext(dur time.Duration, f func(context.Context) error, counts func(error) bool) func(context.Context) error {
+	return func(ctx context.Context) error {
+		begin := time.Now()
+		err := f(ctx)
+		if !counts(err) {
+			return err
+		}
+
+		if e := sleepContext(ctx, dur-time.Now().Sub(begin)); err == nil {
+			err = e
+		}
+		return err
+	}
+}
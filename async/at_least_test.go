@@ -1,6 +1,7 @@
 package async
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -78,3 +79,55 @@ func TestRunCondAtLeast(t *testing.T) {
 		}
 	}
 }
+
+func TestRunAtLeastContext(t *testing.T) {
+	expect := 50 * time.Millisecond
+	f := RunAtLeastContext(expect, func(ctx context.Context) error {
+		return nil
+	})
+
+	begin := time.Now()
+	if err := f(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if actual := time.Now().Sub(begin); actual < expect {
+		t.Errorf("expect %dns, got %dns", expect, actual)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	begin = time.Now()
+	if err := f(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if actual := time.Now().Sub(begin); actual >= expect {
+		t.Errorf("expected waiting to be aborted, got %dns", actual)
+	}
+}
+
+func TestRunCondAtLeastContext(t *testing.T) {
+	expect := 50 * time.Millisecond
+	failed := errors.New("failed")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		f   func(context.Context) error
+		err error
+	}{
+		{RunSuccessAtLeastContext(expect, func(context.Context) error { return nil }), context.Canceled},
+		{RunSuccessAtLeastContext(expect, func(context.Context) error { return failed }), failed},
+		{RunFailedAtLeastContext(expect, func(context.Context) error { return nil }), nil},
+		{RunFailedAtLeastContext(expect, func(context.Context) error { return failed }), failed},
+	}
+
+	for idx, c := range cases {
+		begin := time.Now()
+		if err := c.f(ctx); err != c.err {
+			t.Errorf("#%d: expected %v, got %v", idx, c.err, err)
+		}
+		if actual := time.Now().Sub(begin); actual >= expect {
+			t.Errorf("#%d: expected not to wait, got %dns", idx, actual)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package async
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -104,3 +105,73 @@ func OnceSuccessWithin(dur time.Duration, f func() error) func() error {
 		return ret
 	}
 }
+
+// OnceAtMostContext is identical to OnceAtMost, but waiting (including
+// waiting for other calls) is aborted when ctx is done
+//
+// It returns ctx.Err() without calling f if waiting is aborted.
+func OnceAtMostContext(dur time.Duration, f func(context.Context) error) func(context.Context) error {
+	return onceAtMostContext(dur, f, false)
+}
+
+// OnceSuccessAtMostContext is identical to OnceAtMostContext, but only
+// successful call counts
+func OnceSuccessAtMostContext(dur time.Duration, f func(context.Context) error) func(context.Context) error {
+	return onceAtMostContext(dur, f, true)
+}
+
+func onceAtMostContext(dur time.Duration, f func(context.Context) error, successOnly bool) func(context.Context) error {
+	lock := newCtxLock()
+	last := time.Now().Add(0 - dur)
+	return func(ctx context.Context) error {
+		if err := lock.lock(ctx); err != nil {
+			return err
+		}
+		defer lock.unlock()
+		if err := sleepContext(ctx, dur-time.Now().Sub(last)); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		ret := f(ctx)
+		if !successOnly || ret == nil {
+			last = now
+		}
+		return ret
+	}
+}
+
+// OnceWithinContext is identical to OnceWithin, but waiting for other calls
+// is aborted when ctx is done
+//
+// It returns ctx.Err() without calling f if waiting is aborted.
+func OnceWithinContext(dur time.Duration, f func(context.Context) error) func(context.Context) error {
+	return onceWithinContext(dur, f, false)
+}
+
+// OnceSuccessWithinContext is identical to OnceWithinContext, but only
+// successful call counts
+func OnceSuccessWithinContext(dur time.Duration, f func(context.Context) error) func(context.Context) error {
+	return onceWithinContext(dur, f, true)
+}
+
+func onceWithinContext(dur time.Duration, f func(context.Context) error, successOnly bool) func(context.Context) error {
+	lock := newCtxLock()
+	last := time.Now().Add(0 - dur)
+	return func(ctx context.Context) error {
+		if err := lock.lock(ctx); err != nil {
+			return err
+		}
+		defer lock.unlock()
+		if d := time.Now().Sub(last); d <= dur {
+			return nil
+		}
+
+		now := time.Now()
+		ret := f(ctx)
+		if !successOnly || ret == nil {
+			last = now
+		}
+		return ret
+	}
+}
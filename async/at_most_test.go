@@ -1,6 +1,7 @@
 package async
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -141,3 +142,102 @@ func TestOnceSuccessWithin(t *testing.T) {
 		t.Fatalf("expected run twice, got %d", a)
 	}
 }
+
+func TestOnceAtMostContext(t *testing.T) {
+	expect := 50 * time.Millisecond
+	a := 0
+	f := OnceAtMostContext(expect, func(context.Context) error {
+		a++
+		return nil
+	})
+
+	f(context.Background())
+	begin := time.Now()
+	f(context.Background())
+	if actual := time.Now().Sub(begin); actual < expect {
+		t.Errorf("expect %dns, got %dns", expect, actual)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	begin = time.Now()
+	if err := f(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if actual := time.Now().Sub(begin); actual >= expect {
+		t.Errorf("expected waiting to be aborted, got %dns", actual)
+	}
+	if a != 2 {
+		t.Errorf("expected function not to be called after aborted, got %d calls", a)
+	}
+}
+
+func TestOnceSuccessAtMostContext(t *testing.T) {
+	expect := 50 * time.Millisecond
+	var e error
+	f := OnceSuccessAtMostContext(expect, func(context.Context) error {
+		return e
+	})
+
+	e = errors.New("")
+	f(context.Background())
+	begin := time.Now()
+	e = nil
+	f(context.Background())
+	if actual := time.Now().Sub(begin); actual >= expect {
+		t.Errorf("expect not more than %dns, got %dns", expect, actual)
+	}
+
+	begin = time.Now()
+	f(context.Background())
+	if actual := time.Now().Sub(begin); actual < expect {
+		t.Errorf("expect %dns, got %dns", expect, actual)
+	}
+}
+
+func TestOnceWithinContext(t *testing.T) {
+	expect := 50 * time.Millisecond
+	a := 0
+	f := OnceWithinContext(expect, func(context.Context) error {
+		a++
+		if a == 1 {
+			time.Sleep(expect)
+		}
+		return nil
+	})
+
+	go f(context.Background())
+	time.Sleep(10 * time.Millisecond)
+
+	// waiting for the running call
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	time.Sleep(2 * expect)
+	f(context.Background())
+	f(context.Background())
+	if a != 2 {
+		t.Errorf("expected 2, got %d", a)
+	}
+}
+
+func TestOnceSuccessWithinContext(t *testing.T) {
+	var e error
+	a := 0
+	f := OnceSuccessWithinContext(time.Minute, func(context.Context) error {
+		a++
+		return e
+	})
+
+	e = errors.New("")
+	f(context.Background())
+	e = nil
+	f(context.Background())
+	f(context.Background())
+	if a != 2 {
+		t.Errorf("expected 2, got %d", a)
+	}
+}
@@ -0,0 +1,308 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned by CircuitBreaker without calling the function
+// if the breaker is open
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerState is state of CircuitBreaker
+type BreakerState int
+
+const (
+	// BreakerClosed allows every call, this is initial state
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects every call until cool-down ends
+	BreakerOpen
+	// BreakerHalfOpen allows limited calls to test if upstream recovers
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// breakerBuckets is number of buckets in rolling window
+const breakerBuckets = 10
+
+// BreakerOptions configures CircuitBreaker created by NewCircuitBreaker
+//
+// If both FailureRatio and ConsecutiveFailures are 0, ConsecutiveFailures
+// defaults to 5.
+type BreakerOptions struct {
+	// FailureRatio opens the breaker if ratio of failed calls in the window
+	// reaches it, 0 disables it
+	FailureRatio float64
+	// MinCalls is minimum number of calls in the window for FailureRatio to
+	// apply, default to 10
+	MinCalls int
+	// Window is length of rolling window counting calls, default to 1 minute
+	Window time.Duration
+	// ConsecutiveFailures opens the breaker if that many calls fail in a row,
+	// 0 disables it
+	ConsecutiveFailures int
+	// CoolDown is how long the breaker stays open before trying again,
+	// default to 30 seconds
+	CoolDown time.Duration
+	// HalfOpenCalls is number of trial calls when half-open. The breaker is
+	// closed if all of them succeed. Default to 1.
+	HalfOpenCalls int
+	// TrialTimeout is how long a trial call can take. The breaker opens
+	// again if any trial does not return in time, result of the trial is
+	// ignored. Default to CoolDown.
+	TrialTimeout time.Duration
+	// IsFailure reports whether the error counts as failure, nil means every
+	// non-nil error
+	IsFailure func(error) bool
+	// OnStateChange is called when state changes, after internal lock is
+	// released
+	OnStateChange func(from, to BreakerState)
+}
+
+type breakerBucket struct {
+	epoch    int64 // index of the bucket since zero time
+	success  int
+	failures int
+}
+
+// CircuitBreaker stops calling a function which keeps failing, so callers fail
+// fast instead of piling up on a broken upstream
+//
+//    cb := NewCircuitBreaker(BreakerOptions{FailureRatio: 0.5, CoolDown: 10 * time.Second})
+//    err := cb.Call(func() error {
+//        return client.Exec(param, &result)
+//    })
+//    if err == ErrBreakerOpen {
+//        // upstream is down, use fallback
+//    }
+//
+// It is closed at first. It opens if failure threshold is reached, and
+// rejects calls with ErrBreakerOpen. After cool-down it becomes half-open,
+// allowing a few trial calls: it is closed if they succeed, or opens again if
+// any fails or does not return within TrialTimeout.
+type CircuitBreaker struct {
+	opts   BreakerOptions
+	bucket time.Duration
+
+	lock        sync.Mutex
+	state       BreakerState
+	gen         uint64 // increased when state changes, so results of old calls are ignored
+	openedAt    time.Time
+	consecutive int
+	buckets     [breakerBuckets]breakerBucket
+	trials      int // calls started in half-open state
+	passed      int // successful calls in half-open state
+}
+
+// NewCircuitBreaker creates a CircuitBreaker
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	if opts.FailureRatio <= 0 && opts.ConsecutiveFailures <= 0 {
+		opts.ConsecutiveFailures = 5
+	}
+	if opts.MinCalls <= 0 {
+		opts.MinCalls = 10
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.CoolDown <= 0 {
+		opts.CoolDown = 30 * time.Second
+	}
+	if opts.HalfOpenCalls <= 0 {
+		opts.HalfOpenCalls = 1
+	}
+	if opts.TrialTimeout <= 0 {
+		opts.TrialTimeout = opts.CoolDown
+	}
+
+	bucket := opts.Window / breakerBuckets
+	if bucket <= 0 {
+		bucket = 1
+	}
+	return &CircuitBreaker{opts: opts, bucket: bucket}
+}
+
+// State returns current state of the breaker
+func (b *CircuitBreaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == BreakerOpen && time.Now().Sub(b.openedAt) >= b.opts.CoolDown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// setState changes state, caller must hold the lock. It returns a function
+// to call OnStateChange, which should be called after releasing the lock.
+func (b *CircuitBreaker) setState(to BreakerState) func() {
+	from := b.state
+	b.state = to
+	b.gen++
+	b.consecutive, b.trials, b.passed = 0, 0, 0
+	b.buckets = [breakerBuckets]breakerBucket{}
+	if to == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+
+	if b.opts.OnStateChange == nil {
+		return nil
+	}
+	return func() {
+		b.opts.OnStateChange(from, to)
+	}
+}
+
+// allow checks if a call is allowed, it returns generation of the state, and
+// whether it is a trial call
+func (b *CircuitBreaker) allow() (gen uint64, trial bool, notify func(), err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == BreakerOpen {
+		if time.Now().Sub(b.openedAt) < b.opts.CoolDown {
+			return 0, false, nil, ErrBreakerOpen
+		}
+		notify = b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.trials >= b.opts.HalfOpenCalls {
+			return 0, false, notify, ErrBreakerOpen
+		}
+		b.trials++
+		trial = true
+	}
+
+	return b.gen, trial, notify, nil
+}
+
+// expire opens the breaker if a trial call of gen has timed out
+func (b *CircuitBreaker) expire(gen uint64) func() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if gen != b.gen || b.state != BreakerHalfOpen {
+		return nil
+	}
+	return b.setState(BreakerOpen)
+}
+
+// record counts result of a call, it returns a function to call OnStateChange
+func (b *CircuitBreaker) record(gen uint64, failed bool) func() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if gen != b.gen {
+		return nil
+	}
+
+	if b.state == BreakerHalfOpen {
+		if failed {
+			return b.setState(BreakerOpen)
+		}
+		if b.passed++; b.passed >= b.opts.HalfOpenCalls {
+			return b.setState(BreakerClosed)
+		}
+		return nil
+	}
+
+	epoch := time.Now().UnixNano() / int64(b.bucket)
+	cur := &b.buckets[epoch%breakerBuckets]
+	if cur.epoch != epoch {
+		*cur = breakerBucket{epoch: epoch}
+	}
+	if !failed {
+		cur.success++
+		b.consecutive = 0
+		return nil
+	}
+	cur.failures++
+	b.consecutive++
+
+	if b.opts.ConsecutiveFailures > 0 && b.consecutive >= b.opts.ConsecutiveFailures {
+		return b.setState(BreakerOpen)
+	}
+	if b.opts.FailureRatio <= 0 {
+		return nil
+	}
+
+	total, failures := 0, 0
+	for _, x := range b.buckets {
+		if x.epoch > epoch-breakerBuckets {
+			total += x.success + x.failures
+			failures += x.failures
+		}
+	}
+	if total >= b.opts.MinCalls && float64(failures) >= b.opts.FailureRatio*float64(total) {
+		return b.setState(BreakerOpen)
+	}
+
+	return nil
+}
+
+// Call calls f if the breaker allows, or returns ErrBreakerOpen
+//
+// If f panics, it counts as failure.
+func (b *CircuitBreaker) Call(f func() error) (err error) {
+	return b.CallContext(context.Background(), func(context.Context) error {
+		return f()
+	})
+}
+
+// CallContext is identical to Call, but passes ctx to f. For trial calls, ctx
+// is canceled after TrialTimeout.
+func (b *CircuitBreaker) CallContext(ctx context.Context, f func(context.Context) error) (err error) {
+	gen, trial, notify, err := b.allow()
+	if notify != nil {
+		notify()
+	}
+	if err != nil {
+		return
+	}
+
+	if trial {
+		// a hung trial must not keep the breaker half-open
+		t := time.AfterFunc(b.opts.TrialTimeout, func() {
+			if notify := b.expire(gen); notify != nil {
+				notify()
+			}
+		})
+		defer t.Stop()
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.opts.TrialTimeout)
+		defer cancel()
+	}
+
+	failed := true
+	defer func() {
+		if notify := b.record(gen, failed); notify != nil {
+			notify()
+		}
+	}()
+
+	err = f(ctx)
+	failed = err != nil && (b.opts.IsFailure == nil || b.opts.IsFailure(err))
+	return
+}
+
+// Wrap converts f to a function called through the breaker
+func (b *CircuitBreaker) Wrap(f func() error) func() error {
+	return func() error {
+		return b.Call(f)
+	}
+}
@@ -0,0 +1,201 @@
+package async
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func succeed() error { return nil }
+func fail() error    { return errFailed("failed") }
+
+func TestCircuitBreakerConsecutive(t *testing.T) {
+	var changes []BreakerState
+	cb := NewCircuitBreaker(BreakerOptions{
+		ConsecutiveFailures: 3,
+		CoolDown:            20 * time.Millisecond,
+		OnStateChange: func(from, to BreakerState) {
+			changes = append(changes, to)
+		},
+	})
+
+	cb.Call(fail)
+	cb.Call(fail)
+	cb.Call(succeed)
+	cb.Call(fail)
+	cb.Call(fail)
+	if s := cb.State(); s != BreakerClosed {
+		t.Fatalf("expected success to reset counter, got %s", s)
+	}
+
+	cb.Call(fail)
+	if s := cb.State(); s != BreakerOpen {
+		t.Fatalf("expected breaker to open, got %s", s)
+	}
+	called := false
+	if err := cb.Call(func() error { called = true; return nil }); err != ErrBreakerOpen || called {
+		t.Errorf("expected call to be rejected, got %v (called: %t)", err, called)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if s := cb.State(); s != BreakerHalfOpen {
+		t.Fatalf("expected breaker to be half-open after cool-down, got %s", s)
+	}
+	cb.Call(fail)
+	if s := cb.State(); s != BreakerOpen {
+		t.Fatalf("expected failed trial to open breaker, got %s", s)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if err := cb.Call(succeed); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if s := cb.State(); s != BreakerClosed {
+		t.Fatalf("expected successful trial to close breaker, got %s", s)
+	}
+
+	expect := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if !reflect.DeepEqual(changes, expect) {
+		t.Errorf("expected state changes %v, got %v", expect, changes)
+	}
+}
+
+func TestCircuitBreakerRatio(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerOptions{FailureRatio: 0.5, MinCalls: 4})
+
+	cb.Call(fail)
+	cb.Call(fail)
+	cb.Call(fail)
+	if s := cb.State(); s != BreakerClosed {
+		t.Fatalf("expected MinCalls to be respected, got %s", s)
+	}
+
+	cb.Call(succeed)
+	if s := cb.State(); s != BreakerClosed {
+		t.Fatalf("expected only failure to open breaker, got %s", s)
+	}
+	cb.Call(fail)
+	if s := cb.State(); s != BreakerOpen {
+		t.Fatalf("expected breaker to open at 4/5 failures, got %s", s)
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerOptions{
+		FailureRatio: 0.5,
+		MinCalls:     2,
+		Window:       20 * time.Millisecond,
+	})
+
+	cb.Call(fail)
+	time.Sleep(30 * time.Millisecond)
+	cb.Call(fail)
+	if s := cb.State(); s != BreakerClosed {
+		t.Fatalf("expected old failures to be out of window, got %s", s)
+	}
+	cb.Call(fail)
+	if s := cb.State(); s != BreakerOpen {
+		t.Fatalf("expected breaker to open, got %s", s)
+	}
+}
+
+func TestCircuitBreakerHalfOpenCalls(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerOptions{
+		ConsecutiveFailures: 1,
+		CoolDown:            10 * time.Millisecond,
+		HalfOpenCalls:       2,
+	})
+	cb.Call(fail)
+	time.Sleep(15 * time.Millisecond)
+
+	start, release := make(chan struct{}), make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for x := 0; x < 2; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cb.Call(func() error {
+				start <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	<-start
+	<-start
+
+	if err := cb.Call(succeed); err != ErrBreakerOpen {
+		t.Errorf("expected extra trial to be rejected, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+
+	if s := cb.State(); s != BreakerClosed {
+		t.Errorf("expected breaker to close after trials, got %s", s)
+	}
+}
+
+func TestCircuitBreakerIsFailure(t *testing.T) {
+	ignored := errFailed("ignored")
+	cb := NewCircuitBreaker(BreakerOptions{
+		ConsecutiveFailures: 1,
+		IsFailure:           func(err error) bool { return err != ignored },
+	})
+
+	if err := cb.Call(func() error { return ignored }); err != ignored {
+		t.Errorf("expected error to be returned, got %v", err)
+	}
+	if s := cb.State(); s != BreakerClosed {
+		t.Fatalf("expected ignored error not to count, got %s", s)
+	}
+
+	func() {
+		defer func() { recover() }()
+		cb.Call(func() error { panic("boom") })
+	}()
+	if s := cb.State(); s != BreakerOpen {
+		t.Fatalf("expected panic to count as failure, got %s", s)
+	}
+}
+
+func TestCircuitBreakerTrialTimeout(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerOptions{
+		ConsecutiveFailures: 1,
+		CoolDown:            50 * time.Millisecond,
+		TrialTimeout:        10 * time.Millisecond,
+	})
+	cb.Call(fail)
+	time.Sleep(55 * time.Millisecond)
+
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- cb.CallContext(context.Background(), func(ctx context.Context) error {
+			<-release // hangs, ignoring ctx
+			return nil
+		})
+	}()
+
+	time.Sleep(25 * time.Millisecond)
+	if s := cb.State(); s != BreakerOpen {
+		t.Fatalf("expected hung trial to open breaker, got %s", s)
+	}
+	close(release)
+	<-done
+	if s := cb.State(); s != BreakerOpen {
+		t.Fatalf("expected late result to be ignored, got %s", s)
+	}
+
+	time.Sleep(55 * time.Millisecond)
+	err := cb.CallContext(context.Background(), func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected trial context to have deadline")
+		}
+		return nil
+	})
+	if err != nil || cb.State() != BreakerClosed {
+		t.Errorf("expected successful trial to close breaker, got %v (%s)", err, cb.State())
+	}
+}
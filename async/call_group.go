@@ -0,0 +1,145 @@
+package async
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type groupCall[T any] struct {
+	done   chan struct{}
+	val    T
+	err    error
+	shared bool      // result is used by more than one caller
+	expire time.Time // zero if result is not cached
+}
+
+// CallGroup deduplicates concurrent calls with same key, so they share the
+// result of one call
+//
+// Unlike LockGroup, which makes callers with same key run in turn, callers
+// of CallGroup wait for the running call and get the same result:
+//
+//    g := NewCallGroup[*User](0)
+//    user, err, _ := g.Do("user:"+id, func() (*User, error) {
+//        return loadUserFromDB(id) // called once for concurrent cache misses
+//    })
+//
+// Successful result can be cached for a short time, so callers right after
+// the call also share it. Failed result is never cached.
+type CallGroup[T any] struct {
+	ttl   time.Duration
+	lock  sync.Mutex
+	calls map[string]*groupCall[T]
+}
+
+// NewCallGroup creates a CallGroup which caches successful result for ttl,
+// 0 disables caching
+func NewCallGroup[T any](ttl time.Duration) *CallGroup[T] {
+	return &CallGroup[T]{
+		ttl:   ttl,
+		calls: map[string]*groupCall[T]{},
+	}
+}
+
+// start returns the running or cached call of key, or creates a new one. It
+// returns true if the caller should run the new call.
+func (g *CallGroup[T]) start(key string) (*groupCall[T], bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if c, ok := g.calls[key]; ok && (c.expire.IsZero() || time.Now().Before(c.expire)) {
+		c.shared = true
+		return c, false
+	}
+
+	c := &groupCall[T]{done: make(chan struct{})}
+	g.calls[key] = c
+	return c, true
+}
+
+// run calls f and saves the result
+func (g *CallGroup[T]) run(key string, c *groupCall[T], f func() (T, error)) {
+	err := safeCall(func() (err error) {
+		c.val, err = f()
+		return
+	})
+
+	g.lock.Lock()
+	c.err = err
+	if err == nil && g.ttl > 0 {
+		c.expire = time.Now().Add(g.ttl)
+		time.AfterFunc(g.ttl, func() {
+			g.remove(key, c)
+		})
+	} else if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.lock.Unlock()
+
+	close(c.done)
+}
+
+// remove deletes the call, unless it has been replaced
+func (g *CallGroup[T]) remove(key string, c *groupCall[T]) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// result returns result of finished call
+func (g *CallGroup[T]) result(c *groupCall[T]) (T, error, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return c.val, c.err, c.shared
+}
+
+// Do calls f and returns the result, unless there is a running or cached call
+// with same key, which result is returned instead. shared reports whether the
+// result is used by other callers.
+//
+// If f panics, err is a *PanicError.
+func (g *CallGroup[T]) Do(key string, f func() (T, error)) (v T, err error, shared bool) {
+	c, first := g.start(key)
+	if first {
+		g.run(key, c, f)
+	}
+	<-c.done
+
+	return g.result(c)
+}
+
+// DoContext is identical to Do, but stops waiting when ctx is done, and
+// returns ctx.Err()
+//
+// The call is not canceled as it might be shared by other callers, so the
+// context passed to f is not canceled with ctx.
+func (g *CallGroup[T]) DoContext(ctx context.Context, key string, f func(context.Context) (T, error)) (v T, err error, shared bool) {
+	c, first := g.start(key)
+	if first {
+		fctx := context.WithoutCancel(ctx)
+		go g.run(key, c, func() (T, error) {
+			return f(fctx)
+		})
+	}
+
+	select {
+	case <-c.done:
+		return g.result(c)
+	case <-ctx.Done():
+		return v, ctx.Err(), false
+	}
+}
+
+// Forget drops the running or cached call of key, so next caller calls the
+// function again. Callers waiting for the running call are not affected.
+func (g *CallGroup[T]) Forget(key string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	delete(g.calls, key)
+}
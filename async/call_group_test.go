@@ -0,0 +1,156 @@
+package async
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallGroup(t *testing.T) {
+	g := NewCallGroup[int](0)
+	var calls int32
+	release := make(chan struct{})
+	f := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 42, nil
+	}
+
+	wg := &sync.WaitGroup{}
+	var sharedCnt int32
+	for x := 0; x < 5; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, shared := g.Do("a", f)
+			if v != 42 || err != nil {
+				t.Errorf("unexpected result: %d, %v", v, err)
+			}
+			if shared {
+				atomic.AddInt32(&sharedCnt, 1)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected one call, got %d", calls)
+	}
+	if sharedCnt != 5 {
+		t.Errorf("expected result to be shared by 5 callers, got %d", sharedCnt)
+	}
+
+	if _, _, shared := g.Do("a", f); shared || calls != 2 {
+		t.Errorf("expected result not to be cached, got %d calls", calls)
+	}
+}
+
+func TestCallGroupCache(t *testing.T) {
+	g := NewCallGroup[string](20 * time.Millisecond)
+	var calls int32
+	f := func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "ok", nil
+	}
+
+	g.Do("a", f)
+	if v, _, shared := g.Do("a", f); v != "ok" || !shared || calls != 1 {
+		t.Errorf("expected cached result, got %q (calls: %d)", v, calls)
+	}
+	g.Do("b", f)
+	if calls != 2 {
+		t.Errorf("expected keys to be cached separately, got %d calls", calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	g.Do("a", f)
+	if calls != 3 {
+		t.Errorf("expected cache to expire, got %d calls", calls)
+	}
+
+	g.Forget("a")
+	g.Do("a", f)
+	if calls != 4 {
+		t.Errorf("expected cache to be forgotten, got %d calls", calls)
+	}
+
+	g.lock.Lock()
+	n := len(g.calls)
+	g.lock.Unlock()
+	time.Sleep(30 * time.Millisecond)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if n == 0 || len(g.calls) != 0 {
+		t.Errorf("expected expired results to be removed, got %d => %d", n, len(g.calls))
+	}
+}
+
+func TestCallGroupError(t *testing.T) {
+	g := NewCallGroup[int](time.Minute)
+	var calls int32
+	f := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		return 0, errFailed("failed")
+	}
+
+	g.Do("a", f)
+	if _, err, _ := g.Do("a", f); err == nil || calls != 2 {
+		t.Errorf("expected failed result not to be cached, got %d calls", calls)
+	}
+
+	_, err, _ := g.Do("b", func() (int, error) { panic("boom") })
+	if pe, ok := err.(*PanicError); !ok || pe.Value != "boom" {
+		t.Errorf("expected PanicError, got %#v", err)
+	}
+}
+
+func TestCallGroupForgetRunning(t *testing.T) {
+	g := NewCallGroup[int](0)
+	release := make(chan struct{})
+	done := make(chan int)
+	go func() {
+		v, _, _ := g.Do("a", func() (int, error) {
+			<-release
+			return 1, nil
+		})
+		done <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	g.Forget("a")
+	if v, _, _ := g.Do("a", func() (int, error) { return 2, nil }); v != 2 {
+		t.Errorf("expected new call after forget, got %d", v)
+	}
+	close(release)
+	if v := <-done; v != 1 {
+		t.Errorf("expected running call not to be affected, got %d", v)
+	}
+}
+
+func TestCallGroupContext(t *testing.T) {
+	g := NewCallGroup[int](0)
+	release := make(chan struct{})
+	f := func(ctx context.Context) (int, error) {
+		<-release
+		return 1, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoContext(ctx, "a", f); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	v, err, shared := g.DoContext(context.Background(), "a", f)
+	if v != 1 || err != nil || !shared {
+		t.Errorf("expected running call not to be canceled, got %d, %v, %t", v, err, shared)
+	}
+}
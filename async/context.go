@@ -0,0 +1,54 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// sleepContext waits for the duration, or returns ctx.Err() if ctx is done
+// before that
+func sleepContext(ctx context.Context, dur time.Duration) error {
+	if dur <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(dur)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ctxLock is a mutex which stops waiting when context is done
+type ctxLock chan struct{}
+
+func newCtxLock() ctxLock {
+	return make(ctxLock, 1)
+}
+
+// lock acquires the lock, or returns ctx.Err() if ctx is done before that
+func (l ctxLock) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unlock releases the lock, it panics if not locked
+func (l ctxLock) unlock() {
+	select {
+	case <-l:
+	default:
+		panic(errors.New("unlocking unlocked lock"))
+	}
+}
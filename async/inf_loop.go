@@ -9,9 +9,19 @@ import "context"
 //    - It will not interrupt current loop.
 //    - It will not wait any second between tasks.
 func InfiniteLoop(task func() error) (cancel context.CancelFunc, err chan error) {
-	ctx, cancel := context.WithCancel(context.Background())
+	return InfiniteLoopContext(context.Background(), func(context.Context) error {
+		return task()
+	})
+}
+
+// InfiniteLoopContext is identical to InfiniteLoop, but it also stops when ctx
+// is done, and the context is passed to your function
+func InfiniteLoopContext(ctx context.Context, task func(context.Context) error) (cancel context.CancelFunc, err chan error) {
+	ctx, cancel = context.WithCancel(ctx)
 	err = make(chan error)
-	go doInfiniteLooping(ctx, err, task)
+	go doInfiniteLooping(ctx, err, func() error {
+		return task(ctx)
+	})
 
 	return
 }
@@ -33,11 +43,21 @@ func doInfiniteLooping(ctx context.Context, errchan chan error, task func() erro
 
 // HookedInfiniteLoop is identical with InfiniteLoop, excepts it uses callback instead of channel
 func HookedInfiniteLoop(task func() error, cb func(error)) (cancel context.CancelFunc) {
-	cancel, errchan := InfiniteLoop(task)
+	return HookedInfiniteLoopContext(context.Background(), func(context.Context) error {
+		return task()
+	}, cb)
+}
+
+// HookedInfiniteLoopContext is identical with InfiniteLoopContext, excepts it
+// uses callback instead of channel
+func HookedInfiniteLoopContext(ctx context.Context, task func(context.Context) error, cb func(error)) (cancel context.CancelFunc) {
+	cancel, errchan := InfiniteLoopContext(ctx, task)
 
 	go func() {
+		// always receive, or the loop never exits
+		err := <-errchan
 		if cb != nil {
-			cb(<-errchan)
+			cb(err)
 		}
 	}()
 
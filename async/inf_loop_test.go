@@ -51,3 +51,50 @@ func TestInfiniteLoopCancelAfterDone(t *testing.T) {
 		t.Error("cancel should not work after job done")
 	}
 }
+
+func TestInfiniteLoopContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Millisecond)
+	defer cancel()
+
+	task := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * time.Millisecond):
+		}
+		return nil
+	}
+
+	_, errchan := InfiniteLoopContext(ctx, task)
+	select {
+	case err := <-errchan:
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected loop to stop when context is done")
+	}
+}
+
+func TestHookedInfiniteLoopContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Millisecond)
+	defer cancel()
+
+	task := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * time.Millisecond):
+		}
+		return nil
+	}
+
+	errchan := make(chan error, 1)
+	HookedInfiniteLoopContext(ctx, task, func(err error) { errchan <- err })
+	select {
+	case err := <-errchan:
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected callback to be called when context is done")
+	}
+}
@@ -1,13 +1,14 @@
 package async
 
 import (
+	"context"
 	"errors"
 	"sync"
 )
 
 type lockGroupElement struct {
 	counter uint
-	sync.Mutex
+	lock    ctxLock
 }
 
 // LockGroup is a container of dynamic numbers of lock
@@ -31,7 +32,7 @@ type LockGroup struct {
 }
 
 func (l *LockGroup) newElement() *lockGroupElement {
-	return &lockGroupElement{}
+	return &lockGroupElement{lock: newCtxLock()}
 }
 
 func (l *LockGroup) send(m map[string]*lockGroupElement) {
@@ -40,29 +41,28 @@ func (l *LockGroup) send(m map[string]*lockGroupElement) {
 	}()
 }
 
-// Lock locks the specified row-lock
-func (l *LockGroup) Lock(key string) {
+// ref returns lock object of key, creates one if not exist
+func (l *LockGroup) ref(key string) *lockGroupElement {
 	m := <-l.ch
 	e, ok := m[key]
 	if !ok {
 		e = l.newElement()
 		m[key] = e
 	}
-	defer e.Lock()
 
 	e.counter++
 	l.send(m)
+	return e
 }
 
-// Unlock unlocks the specified row-lock.
-// It panics if it is not locked on entry to Unlock.
-func (l *LockGroup) Unlock(key string) {
+// unref releases lock object of key, clears it if unused
+func (l *LockGroup) unref(key string) *lockGroupElement {
 	m := <-l.ch
 	e, ok := m[key]
 	if !ok {
+		l.send(m)
 		panic(errors.New("unlocking non-exist lock: " + key))
 	}
-	defer e.Unlock()
 
 	e.counter--
 	if e.counter == 0 {
@@ -70,6 +70,29 @@ func (l *LockGroup) Unlock(key string) {
 	}
 
 	l.send(m)
+	return e
+}
+
+// Lock locks the specified row-lock
+func (l *LockGroup) Lock(key string) {
+	l.ref(key).lock.lock(context.Background())
+}
+
+// LockContext is identical to Lock, but returns ctx.Err() if ctx is done
+// before the row-lock is acquired
+func (l *LockGroup) LockContext(ctx context.Context, key string) error {
+	err := l.ref(key).lock.lock(ctx)
+	if err != nil {
+		l.unref(key)
+	}
+
+	return err
+}
+
+// Unlock unlocks the specified row-lock.
+// It panics if it is not locked on entry to Unlock.
+func (l *LockGroup) Unlock(key string) {
+	l.unref(key).lock.unlock()
 }
 
 // Locker wraps specified row-lock to sync.Locker, so you can use it
@@ -1,6 +1,7 @@
 package async
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -50,3 +51,30 @@ func TestLockGroup(t *testing.T) {
 		}
 	})
 }
+
+func TestLockGroupContext(t *testing.T) {
+	l := NewLockGroup()
+	l.Lock("a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.LockContext(ctx, "a"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- l.LockContext(context.Background(), "a")
+	}()
+	l.Unlock("a")
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	l.Unlock("a")
+
+	m := <-l.ch
+	l.send(m)
+	if len(m) != 0 {
+		t.Errorf("expected unused locks to be cleared, got %d", len(m))
+	}
+}
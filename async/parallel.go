@@ -0,0 +1,102 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// ParallelOptions configures ParallelMap and ForEach
+type ParallelOptions struct {
+	// Workers is max number of concurrent calls, default to runtime.NumCPU()
+	Workers int
+	// StopOnError stops processing remaining items when any call fails, and
+	// cancels context passed to running calls
+	StopOnError bool
+}
+
+// ParallelMap calls f for each item concurrently, results are in same order
+// as items
+//
+//    users, err := ParallelMap(ctx, ids, ParallelOptions{Workers: 8}, loadUser)
+//
+// Panics in f are converted to *PanicError. If StopOnError is set, it returns
+// the first error, and results of unprocessed items are zero values.
+// Otherwise every item is processed, and errors are joined in order of items.
+//
+// It returns ctx.Err() if ctx is done before every item is processed.
+func ParallelMap[T, R any](ctx context.Context, items []T, opts ParallelOptions, f func(context.Context, T) (R, error)) ([]R, error) {
+	n := opts.Workers
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	if n > len(items) {
+		n = len(items)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ret := make([]R, len(items))
+	errs := make([]error, len(items))
+	var (
+		lock  sync.Mutex
+		next  int
+		first error
+	)
+	// take returns index of next item, or -1 if it should stop
+	take := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		if next >= len(items) || ctx.Err() != nil {
+			return -1
+		}
+		next++
+		return next - 1
+	}
+	fail := func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if first == nil {
+			first = err
+			cancel()
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(n)
+	for x := 0; x < n; x++ {
+		go func() {
+			defer wg.Done()
+			for idx := take(); idx >= 0; idx = take() {
+				errs[idx] = safeCall(func() (err error) {
+					ret[idx], err = f(ctx, items[idx])
+					return
+				})
+				if errs[idx] != nil && opts.StopOnError {
+					fail(errs[idx])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if first != nil {
+		return ret, first
+	}
+	if next < len(items) {
+		// stopped by ctx
+		return ret, ctx.Err()
+	}
+
+	return ret, errors.Join(errs...)
+}
+
+// ForEach is identical to ParallelMap, but for functions without result
+func ForEach[T any](ctx context.Context, items []T, opts ParallelOptions, f func(context.Context, T) error) error {
+	_, err := ParallelMap(ctx, items, opts, func(ctx context.Context, item T) (struct{}, error) {
+		return struct{}{}, f(ctx, item)
+	})
+	return err
+}
@@ -0,0 +1,91 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallelMap(t *testing.T) {
+	items := []int{5, 1, 4, 2, 3}
+	var running, max int32
+	ret, err := ParallelMap(context.Background(), items, ParallelOptions{Workers: 2}, func(ctx context.Context, i int) (string, error) {
+		if cur := atomic.AddInt32(&running, 1); cur > atomic.LoadInt32(&max) {
+			atomic.StoreInt32(&max, cur)
+		}
+		defer atomic.AddInt32(&running, -1)
+		time.Sleep(time.Duration(i) * time.Millisecond)
+		return strconv.Itoa(i), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expect := []string{"5", "1", "4", "2", "3"}; !reflect.DeepEqual(ret, expect) {
+		t.Errorf("expected %v, got %v", expect, ret)
+	}
+	if atomic.LoadInt32(&max) > 2 {
+		t.Errorf("expected at most 2 workers, got %d", max)
+	}
+}
+
+func TestParallelMapErrors(t *testing.T) {
+	items := []int{1, 2, 3, 4}
+	f := func(ctx context.Context, i int) (int, error) {
+		if i%2 == 0 {
+			return 0, errFailed("failed " + strconv.Itoa(i))
+		}
+		return i * 10, nil
+	}
+
+	ret, err := ParallelMap(context.Background(), items, ParallelOptions{Workers: 1}, f)
+	if !reflect.DeepEqual(ret, []int{10, 0, 30, 0}) {
+		t.Errorf("expected every item to be processed, got %v", ret)
+	}
+	if err == nil || err.Error() != "failed 2\nfailed 4" {
+		t.Errorf("expected joined errors, got %v", err)
+	}
+
+	var cnt int32
+	err = ForEach(context.Background(), items, ParallelOptions{Workers: 1, StopOnError: true}, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&cnt, 1)
+		_, err := f(ctx, i)
+		return err
+	})
+	if err == nil || err.Error() != "failed 2" {
+		t.Errorf("expected first error, got %v", err)
+	}
+	if cnt != 2 {
+		t.Errorf("expected to stop on first error, got %d calls", cnt)
+	}
+}
+
+func TestParallelMapPanic(t *testing.T) {
+	err := ForEach(context.Background(), []int{1}, ParallelOptions{}, func(context.Context, int) error {
+		panic("boom")
+	})
+
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" {
+		t.Errorf("expected PanicError, got %#v", err)
+	}
+}
+
+func TestParallelMapContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var cnt int32
+	err := ForEach(ctx, []int{1, 2, 3}, ParallelOptions{Workers: 1}, func(context.Context, int) error {
+		atomic.AddInt32(&cnt, 1)
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expected canceled, got %v", err)
+	}
+	if cnt != 1 {
+		t.Errorf("expected to stop when canceled, got %d calls", cnt)
+	}
+}
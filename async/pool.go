@@ -0,0 +1,166 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrPoolClosed is returned for tasks submitted to a closed Pool, or dropped
+// from queue when shutting down
+var ErrPoolClosed = errors.New("worker pool is closed")
+
+// PanicError is returned for tasks which panic
+type PanicError struct {
+	Value interface{} // value passed to panic
+	Stack []byte      // stack trace of the panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// safeCall calls f, converting panic to *PanicError
+func safeCall(f func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	return f()
+}
+
+type poolTask struct {
+	ctx    context.Context
+	f      func(context.Context) error
+	result chan error
+}
+
+// Pool runs tasks with fixed number of workers
+//
+//    p := NewPool(4, 100)
+//    defer p.Shutdown(context.Background())
+//    errchan := p.Submit(ctx, func(ctx context.Context) error {
+//        return process(ctx, job)
+//    })
+//    err := <-errchan
+//
+// Tasks are queued if all workers are busy, and Submit blocks if the queue is
+// full.
+type Pool struct {
+	tasks  chan poolTask
+	ctx    context.Context // canceled when shutdown is forced
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	lock   sync.RWMutex // protects tasks from being closed when sending
+	closed bool
+	quit   chan struct{} // closed when shutting down, to wake up blocked Submit
+	once   sync.Once
+}
+
+// NewPool creates a Pool with size workers and a queue of queue tasks
+//
+// It panics if size is not positive.
+func NewPool(size, queue int) *Pool {
+	if size <= 0 {
+		panic(errors.New("size of worker pool must be positive"))
+	}
+	if queue < 0 {
+		queue = 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		tasks:  make(chan poolTask, queue),
+		ctx:    ctx,
+		cancel: cancel,
+		quit:   make(chan struct{}),
+	}
+	p.wg.Add(size)
+	for x := 0; x < size; x++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for t := range p.tasks {
+		if p.ctx.Err() != nil {
+			t.result <- ErrPoolClosed
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(t.ctx)
+		stop := context.AfterFunc(p.ctx, cancel)
+		t.result <- safeCall(func() error {
+			return t.f(ctx)
+		})
+		stop()
+		cancel()
+	}
+}
+
+// Submit queues a task, and returns a channel receiving its result
+//
+// It blocks if the queue is full, until there is room, ctx is done or the pool
+// is shut down. The channel receives ctx.Err() or ErrPoolClosed in those
+// cases. Context passed to task is canceled if ctx is done, or shutdown is
+// forced.
+func (p *Pool) Submit(ctx context.Context, task func(context.Context) error) chan error {
+	ret := make(chan error, 1)
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		ret <- ErrPoolClosed
+		return ret
+	}
+
+	select {
+	case p.tasks <- poolTask{ctx: ctx, f: task, result: ret}:
+	case <-ctx.Done():
+		ret <- ctx.Err()
+	case <-p.quit:
+		ret <- ErrPoolClosed
+	}
+
+	return ret
+}
+
+// Shutdown stops accepting tasks, and waits for queued and running tasks to
+// finish
+//
+// If ctx is done before that, shutdown is forced: context of running tasks
+// is canceled, and queued tasks are dropped with ErrPoolClosed. It still
+// waits for running tasks to return, and then returns ctx.Err().
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.once.Do(func() {
+		close(p.quit)
+		p.lock.Lock()
+		p.closed = true
+		close(p.tasks)
+		p.lock.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,122 @@
+package async
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(2, 10)
+	var running, max int32
+	task := func(context.Context) error {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&max)
+			if cur <= old || atomic.CompareAndSwapInt32(&max, old, cur) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	results := make([]chan error, 6)
+	for x := range results {
+		results[x] = p.Submit(context.Background(), task)
+	}
+	for _, ch := range results {
+		if err := <-ch; err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+	if max != 2 {
+		t.Errorf("expected 2 concurrent tasks, got %d", max)
+	}
+
+	if err := <-p.Submit(context.Background(), func(context.Context) error { panic("boom") }); err == nil {
+		t.Error("expected panic to be captured")
+	} else if pe, ok := err.(*PanicError); !ok || pe.Value != "boom" {
+		t.Errorf("expected PanicError, got %#v", err)
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := <-p.Submit(context.Background(), task); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed after shutdown, got %v", err)
+	}
+}
+
+func TestPoolBackpressure(t *testing.T) {
+	p := NewPool(1, 1)
+	defer p.Shutdown(context.Background())
+	release := make(chan struct{})
+	block := func(context.Context) error {
+		<-release
+		return nil
+	}
+
+	first := p.Submit(context.Background(), block)
+	time.Sleep(5 * time.Millisecond) // wait for worker to take it
+	second := p.Submit(context.Background(), block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := <-p.Submit(ctx, block); err != context.DeadlineExceeded {
+		t.Errorf("expected Submit to block when queue is full, got %v", err)
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := <-second; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestPoolShutdownDrain(t *testing.T) {
+	p := NewPool(1, 5)
+	var cnt int32
+	results := make([]chan error, 5)
+	for x := range results {
+		results[x] = p.Submit(context.Background(), func(context.Context) error {
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt32(&cnt, 1)
+			return nil
+		})
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if cnt != 5 {
+		t.Errorf("expected queued tasks to be drained, got %d", cnt)
+	}
+}
+
+func TestPoolShutdownForced(t *testing.T) {
+	p := NewPool(1, 5)
+	running := p.Submit(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	queued := p.Submit(context.Background(), func(context.Context) error {
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if err := <-running; err != context.Canceled {
+		t.Errorf("expected running task to be canceled, got %v", err)
+	}
+	if err := <-queued; err != ErrPoolClosed {
+		t.Errorf("expected queued task to be dropped, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Jitter randomizes delays of Retry, so clients failed at the same time do
+// not retry at the same time again
+type Jitter int
+
+const (
+	// NoJitter uses the computed delay as is
+	NoJitter Jitter = iota
+	// FullJitter waits random time between 0 and the computed delay
+	FullJitter
+	// DecorrelatedJitter waits random time between initial delay and 3 times
+	// of previous delay, ignoring Multiplier
+	DecorrelatedJitter
+)
+
+// permanentError marks an error not to be retried
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so Retry stops retrying and returns err. It works even
+// if the result is wrapped again, like fmt.Errorf("load: %w", Permanent(err)).
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err: err}
+}
+
+// Retry calls a function until it succeeds, waiting between attempts with
+// exponential backoff
+//
+//    r := Retry{MaxAttempts: 5, Jitter: FullJitter}
+//    err := r.Do(ctx, func(ctx context.Context) error {
+//        return callAPI(ctx)
+//    })
+//
+// It can be combined with other helpers, as Wrap returns a function with same
+// signature:
+//
+//    // retry up to 3 times, and not more than once per second for each retry
+//    f := Retry{MaxAttempts: 3}.Wrap(OnceAtMostContext(time.Second, callAPI))
+//
+// The zero value retries every error forever with delays 100ms, 200ms, 400ms...
+type Retry struct {
+	// MaxAttempts limits number of calls, including first one. 0 means unlimited.
+	MaxAttempts int
+	// MaxElapsed limits time since first call, it gives up if next attempt
+	// would start after it. 0 means unlimited.
+	MaxElapsed time.Duration
+	// Initial is the delay before second attempt, default to 100ms
+	Initial time.Duration
+	// Max limits the delay between attempts, 0 means unlimited
+	Max time.Duration
+	// Multiplier is the factor delay grows for each attempt, default to 2
+	Multiplier float64
+	// Jitter randomizes delays, default to NoJitter
+	Jitter Jitter
+	// Retryable reports whether the error should be retried, nil means every
+	// error except those wrapped by Permanent
+	Retryable func(error) bool
+	// OnAttempt is called after each attempt, like for logging. err is the
+	// result of the attempt, and next is the delay before next attempt, which
+	// is 0 if it is not going to retry.
+	OnAttempt func(attempt int, err error, next time.Duration)
+}
+
+// retryable reports whether err should be retried
+func (r Retry) retryable(err error) bool {
+	var p permanentError
+	if errors.As(err, &p) {
+		return false
+	}
+
+	return r.Retryable == nil || r.Retryable(err)
+}
+
+// delay computes delay before next attempt from previous one
+func (r Retry) delay(prev time.Duration) time.Duration {
+	initial := r.Initial
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	mul := r.Multiplier
+	if mul <= 0 {
+		mul = 2
+	}
+
+	// limit values to prevent overflow
+	ret := time.Duration(math.MaxInt64)
+	switch {
+	case prev == 0:
+		ret = initial
+	case r.Jitter == DecorrelatedJitter:
+		upper := ret
+		if prev < math.MaxInt64/3 {
+			upper = prev * 3
+		}
+		ret = initial
+		if upper > initial {
+			ret += time.Duration(rand.Int63n(int64(upper - initial)))
+		}
+	default:
+		if d := float64(prev) * mul; d < math.MaxInt64 {
+			ret = time.Duration(d)
+		}
+	}
+	if r.Max > 0 && ret > r.Max {
+		ret = r.Max
+	}
+
+	return ret
+}
+
+// fullJitter returns random delay between 0 and d
+func fullJitter(d time.Duration) time.Duration {
+	// prevent d+1 from overflow
+	if d >= math.MaxInt64 {
+		d = math.MaxInt64 - 1
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// Do calls f until it succeeds or gives up, and returns the result of last
+// call
+//
+// It returns ctx.Err() if ctx is done when waiting.
+func (r Retry) Do(ctx context.Context, f func(context.Context) error) error {
+	begin := time.Now()
+	var prev time.Duration
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		retry := err != nil && r.retryable(err) && (r.MaxAttempts <= 0 || attempt < r.MaxAttempts)
+		if p, ok := err.(permanentError); ok {
+			err = p.err
+		}
+
+		next := time.Duration(0)
+		if retry {
+			prev = r.delay(prev)
+			next = prev
+			if r.Jitter == FullJitter {
+				next = fullJitter(next)
+			}
+			if r.MaxElapsed > 0 && next > r.MaxElapsed-time.Now().Sub(begin) {
+				retry, next = false, 0
+			}
+		}
+
+		if r.OnAttempt != nil {
+			r.OnAttempt(attempt, err, next)
+		}
+		if !retry {
+			return err
+		}
+		if err := sleepContext(ctx, next); err != nil {
+			return err
+		}
+	}
+}
+
+// Wrap converts f to a function retrying with r
+func (r Retry) Wrap(f func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return r.Do(ctx, f)
+	}
+}
+
+// WrapFunc is identical to Wrap, but for function without context, like
+// those created by RunFailedAtLeast
+func (r Retry) WrapFunc(f func() error) func() error {
+	return func() error {
+		return r.Do(context.Background(), func(context.Context) error {
+			return f()
+		})
+	}
+}
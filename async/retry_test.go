@@ -0,0 +1,152 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var delays []time.Duration
+	cnt := 0
+	r := Retry{
+		Initial: time.Millisecond,
+		OnAttempt: func(attempt int, err error, next time.Duration) {
+			if attempt != len(delays)+1 {
+				t.Errorf("unexpected attempt %d", attempt)
+			}
+			delays = append(delays, next)
+		},
+	}
+
+	err := r.Do(context.Background(), func(context.Context) error {
+		if cnt++; cnt < 4 {
+			return errFailed("failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 0}
+	if !reflect.DeepEqual(delays, expect) {
+		t.Errorf("expected delays %v, got %v", expect, delays)
+	}
+}
+
+func TestRetryGiveUp(t *testing.T) {
+	failed := errFailed("failed")
+	cases := []struct {
+		name   string
+		r      Retry
+		err    error
+		expect int
+	}{
+		{"MaxAttempts", Retry{MaxAttempts: 3}, failed, 3},
+		{"MaxElapsed", Retry{MaxElapsed: 6 * time.Millisecond, Multiplier: 1}, failed, 2},
+		{"Permanent", Retry{}, Permanent(failed), 1},
+		{"WrappedPermanent", Retry{}, fmt.Errorf("load: %w", Permanent(failed)), 1},
+		{"Retryable", Retry{Retryable: func(err error) bool { return err != failed }}, failed, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cnt := 0
+			c.r.Initial = 4 * time.Millisecond
+			err := c.r.Do(context.Background(), func(context.Context) error {
+				cnt++
+				return c.err
+			})
+			if !errors.Is(err, failed) {
+				t.Errorf("expected last error, got %v", err)
+			}
+			if cnt != c.expect {
+				t.Errorf("expected %d attempts, got %d", c.expect, cnt)
+			}
+		})
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	begin := time.Now()
+	err := Retry{Initial: time.Second}.Do(ctx, func(context.Context) error {
+		return errFailed("failed")
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if d := time.Now().Sub(begin); d >= time.Second {
+		t.Errorf("expected waiting to be aborted, got %s", d)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := Retry{Initial: 10 * time.Millisecond, Max: 35 * time.Millisecond}
+	var actual []time.Duration
+	for d := r.delay(0); len(actual) < 4; d = r.delay(d) {
+		actual = append(actual, d)
+	}
+	expect := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 35 * time.Millisecond, 35 * time.Millisecond}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("expected %v, got %v", expect, actual)
+	}
+
+	r.Max = 0
+	if d := r.delay(time.Duration(1 << 62)); d <= 0 {
+		t.Errorf("expected not to overflow, got %s", d)
+	}
+
+	if d := fullJitter(math.MaxInt64); d < 0 {
+		t.Errorf("expected full jitter not to overflow, got %s", d)
+	}
+
+	r.Jitter = DecorrelatedJitter
+	for x := 0; x < 100; x++ {
+		if d := r.delay(20 * time.Millisecond); d < r.Initial || d >= 60*time.Millisecond {
+			t.Fatalf("decorrelated jitter out of range: %s", d)
+		}
+	}
+}
+
+func TestRetryWrapFunc(t *testing.T) {
+	cnt := 0
+	f := Retry{Initial: time.Millisecond, MaxAttempts: 3}.WrapFunc(
+		RunFailedAtLeast(5*time.Millisecond, func() error {
+			cnt++
+			return errors.New("failed")
+		}),
+	)
+
+	begin := time.Now()
+	if err := f(); err == nil {
+		t.Error("expected error")
+	}
+	if cnt != 3 {
+		t.Errorf("expected 3 attempts, got %d", cnt)
+	}
+	if d := time.Now().Sub(begin); d < 15*time.Millisecond {
+		t.Errorf("expected wrapped function to be throttled, got %s", d)
+	}
+}
+
+func TestRetryHugeDelay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	cnt := 0
+	r := Retry{Initial: math.MaxInt64, MaxElapsed: time.Minute}
+	err := r.Do(ctx, func(context.Context) error {
+		cnt++
+		return errors.New("fail")
+	})
+	if err == nil || err == context.DeadlineExceeded || cnt != 1 {
+		t.Errorf("expected to give up after first attempt, got %v after %d attempts", err, cnt)
+	}
+}
@@ -0,0 +1,20 @@
+module github.com/Ronmi/rtoolkit
+
+go 1.23
+
+require (
+	github.com/go-redis/redis v6.15.9+incompatible
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/mxk/go-sqlite v0.0.0-20140611214908-167da9432e1f
+	gopkg.in/telegram-bot-api.v4 v4.6.4
+)
+
+require (
+	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible // indirect
+	github.com/onsi/ginkgo v1.16.5 // indirect
+	github.com/onsi/gomega v1.27.10 // indirect
+	github.com/technoweenie/multipartstreamer v1.0.1 // indirect
+)
@@ -2,6 +2,7 @@ package apitool
 
 import (
 	"context"
+	"errors"
 
 	"github.com/Ronmi/rtoolkit/jsonapi"
 	"github.com/Ronmi/rtoolkit/session"
@@ -18,6 +19,12 @@ import (
 //
 // Created middleware will try to save update cookie ttl value if possible. It
 // fails silently.
+//
+// session.ErrConflict (or error wrapping it) returned by your handler is
+// converted to jsonapi.E409.
+//
+// Store operations are done with context of the request, so they are
+// cancelled if client has gone.
 func Session(m *session.Manager) jsonapi.Middleware {
 	return func(h jsonapi.Handler) jsonapi.Handler {
 		return func(req jsonapi.Request) (i interface{}, e error) {
@@ -32,9 +39,13 @@ func Session(m *session.Manager) jsonapi.Middleware {
 				session.SessionObjectKey,
 				sess,
 			))
+			defer sess.Close()
 			i, e = h(jsonapi.WrapRequest(req, r))
+			if errors.Is(e, session.ErrConflict) {
+				i, e = nil, jsonapi.E409.SetOrigin(e)
+			}
 
-			_ = sess.Save(req.W())
+			_ = sess.SaveContext(r.Context(), req.W())
 			return
 		}
 	}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Ronmi/rtoolkit/middleware"
+)
+
+// Middleware wraps a handler with extra logic
+type Middleware func(http.Handler) http.Handler
+
+// FromMiddleware converts a middleware.Middleware to Middleware
+//
+// Next handler of m is replaced by the wrapped handler.
+func FromMiddleware(m *middleware.Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		return m.Clone(next)
+	}
+}
+
+// Group registers handlers to PathMux with common prefix and middlewares
+//
+// It can be used with jsonapi.Register to save typing the prefix:
+//
+//    v1 := mux.Group("/api/v1", auth)
+//    jsonapi.Register(v1, apis)
+//    v1.With(logging).HandleFunc("GET /user/{id}", showUser)
+//
+// Like PathMux, routes can be registered to Group at any time.
+type Group struct {
+	mux    *PathMux
+	prefix string
+	mws    []Middleware
+}
+
+// Group creates a Group registering handlers under prefix
+//
+// Middlewares are applied in order: the first one is outermost.
+func (m *PathMux) Group(prefix string, mws ...Middleware) *Group {
+	return (&Group{mux: m}).Group(prefix, mws...)
+}
+
+// With creates a Group without prefix, so middlewares can be applied to
+// individual handlers
+func (m *PathMux) With(mws ...Middleware) *Group {
+	return m.Group("", mws...)
+}
+
+// Group creates a sub group, prefix and middlewares are appended to current
+// group
+//
+// It panics if prefix is not empty and does not begin with "/".
+func (g *Group) Group(prefix string, mws ...Middleware) *Group {
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		panic(errors.New("mux: prefix must begin with /"))
+	}
+
+	arr := make([]Middleware, 0, len(g.mws)+len(mws))
+	return &Group{
+		mux:    g.mux,
+		prefix: g.prefix + strings.TrimRight(prefix, "/"),
+		mws:    append(append(arr, g.mws...), mws...),
+	}
+}
+
+// With creates a sub group with same prefix and more middlewares
+func (g *Group) With(mws ...Middleware) *Group {
+	return g.Group("", mws...)
+}
+
+// wrap applies middlewares to h
+func (g *Group) wrap(h http.Handler) http.Handler {
+	for x := len(g.mws) - 1; x >= 0; x-- {
+		h = g.mws[x](h)
+	}
+
+	return h
+}
+
+// Handle registers a handler for prefix + pattern, see PathMux.Handle
+//
+//    g := mux.Group("/api")
+//    g.Handle("GET /user/{id}", h) // same as mux.Handle("GET /api/user/{id}", h)
+func (g *Group) Handle(pattern string, h http.Handler) {
+	g.mux.Handle(g.pattern(pattern), g.wrap(h))
+}
+
+// pattern prepends prefix to path of pattern
+func (g *Group) pattern(pattern string) string {
+	method, path := splitMethod(pattern)
+	if !strings.HasPrefix(path, "/") || (method == "" && path != pattern) {
+		panic(errors.New("mux: pattern must begin with /"))
+	}
+	if method != "" {
+		method += " "
+	}
+
+	return method + g.prefix + path
+}
+
+// HandleFunc registers a handler function for prefix + pattern
+func (g *Group) HandleFunc(pattern string, h func(http.ResponseWriter, *http.Request)) {
+	g.Handle(pattern, http.HandlerFunc(h))
+}
+
+// Mount registers a handler for all paths under prefix, see PathMux.Mount
+func (g *Group) Mount(prefix string, h http.Handler) {
+	if !strings.HasPrefix(prefix, "/") {
+		panic(errors.New("mux: prefix must begin with /"))
+	}
+
+	g.mux.Mount(g.prefix+prefix, g.wrap(h))
+}
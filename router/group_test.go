@@ -0,0 +1,148 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Ronmi/rtoolkit/middleware"
+)
+
+// tag is a middleware appending name to X-Trace header
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func serve(m http.Handler, method, uri string) *httptest.ResponseRecorder {
+	req := makeReq(uri)
+	req.Method = method
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	return w
+}
+
+func TestGroup(t *testing.T) {
+	m := ByPath()
+	api := m.Group("/api/", tag("api"))
+	v1 := api.Group("/v1", tag("v1"))
+	v1.HandleFunc("GET /user/{id}", h)
+	v1.With(tag("admin")).HandleFunc("DELETE /user/{id}", h)
+	api.HandleFunc("/ping", h)
+	m.With(tag("root")).HandleFunc("GET /", h)
+
+	cases := []struct {
+		method string
+		uri    string
+		code   int
+		trace  []string
+	}{
+		{"GET", "http://localhost/api/v1/user/1", 200, []string{"api", "v1"}},
+		{"DELETE", "http://localhost/api/v1/user/1", 200, []string{"api", "v1", "admin"}},
+		{"POST", "http://localhost/api/v1/user/1", 405, nil},
+		{"POST", "http://localhost/api/ping", 200, []string{"api"}},
+		{"GET", "http://localhost/other", 200, []string{"root"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.method+" "+c.uri, func(t *testing.T) {
+			w := serve(m, c.method, c.uri)
+			if w.Code != c.code {
+				t.Errorf("expected status %d, got %d", c.code, w.Code)
+			}
+			if trace := w.Header()["X-Trace"]; !reflect.DeepEqual(trace, c.trace) {
+				t.Errorf("expected middlewares %v, got %v", c.trace, trace)
+			}
+		})
+	}
+}
+
+func TestGroupInvalid(t *testing.T) {
+	cases := map[string]func(m *PathMux){
+		"Prefix":  func(m *PathMux) { m.Group("api") },
+		"Pattern": func(m *PathMux) { m.Group("/api").HandleFunc("GET user", h) },
+		"Mount":   func(m *PathMux) { m.Group("/api").Mount("user", ByPath()) },
+	}
+
+	for name, f := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected to panic, but not")
+				}
+			}()
+			f(ByPath())
+		})
+	}
+}
+
+func TestMount(t *testing.T) {
+	var path string
+	var data []string
+	var params Params
+	sub := ByPath()
+	sub.HandleFunc("GET /user/{id}", func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		data, _ = GetPathVariable(r.Context())
+		params, _ = GetPathParams(r.Context())
+	})
+
+	m := ByPath()
+	m.Group("/api", tag("api")).Mount("/{version}", sub)
+
+	w := serve(m, "GET", "http://localhost/api/v1/user/1")
+	if w.Code != 200 {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if path != "/user/1" {
+		t.Errorf("expected prefix to be stripped, got %s", path)
+	}
+	if !reflect.DeepEqual(data, []string{"v1", "1"}) {
+		t.Errorf("unexpected variables: %#v", data)
+	}
+	if !reflect.DeepEqual(params, Params{{"version", "v1"}, {"id", "1"}}) {
+		t.Errorf("unexpected params: %#v", params)
+	}
+	if trace := w.Header().Get("X-Trace"); trace != "api" {
+		t.Errorf("expected middleware to be applied, got '%s'", trace)
+	}
+
+	if w := serve(m, "GET", "http://localhost/api/v1/post/1"); w.Code != 404 {
+		t.Errorf("expected status 404 from mounted mux, got %d", w.Code)
+	}
+	if w := serve(m, "POST", "http://localhost/api/v1/user/1"); w.Code != 405 {
+		t.Errorf("expected status 405 from mounted mux, got %d", w.Code)
+	}
+}
+
+func TestFromMiddleware(t *testing.T) {
+	deny := &middleware.Middleware{
+		Handler: func(w http.ResponseWriter, r *http.Request) (error, *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/secret") {
+				return errors.New("denied"), r
+			}
+			return nil, r
+		},
+	}
+	deny.WrapErrHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	m := ByPath()
+	g := m.Group("/files", FromMiddleware(deny))
+	g.HandleFunc("/{name}", h)
+
+	if w := serve(m, "GET", "http://localhost/files/public"); w.Code != 200 {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+	if w := serve(m, "GET", "http://localhost/files/secret"); w.Code != 403 {
+		t.Errorf("expected status 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,216 @@
+package router
+
+import (
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// hostname strips port and trailing dot from host, and converts to lower case
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// splitLabels splits host pattern by ".", except those in variables
+func splitLabels(pattern string) []string {
+	ret := []string{}
+	depth, begin := 0, 0
+	for x, c := range pattern {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '.':
+			if depth == 0 {
+				ret = append(ret, pattern[begin:x])
+				begin = x + 1
+			}
+		}
+	}
+
+	return append(ret, pattern[begin:])
+}
+
+// reverseStrings reverses arr in place
+func reverseStrings(arr []string) []string {
+	for i, j := 0, len(arr)-1; i < j; i, j = i+1, j-1 {
+		arr[i], arr[j] = arr[j], arr[i]
+	}
+
+	return arr
+}
+
+// HostMux is a http.Handler dispatches by Host header, normally used with
+// PathMux of each host
+//
+// Host names are matched case-insensitively, port is ignored.
+type HostMux struct {
+	// hosts stores labels of host name in reverse order, like path segments
+	hosts *pathNode
+	radix *radixNode
+	// ErrHandler is used if no host matches, you can set it to a PathMux as
+	// default host
+	ErrHandler http.Handler
+}
+
+// ByHost creates a new HostMux with default settings.
+//
+// Error handler returns 404 NOT FOUND.
+func ByHost() *HostMux {
+	return &HostMux{
+		hosts:      createPathNode(),
+		radix:      compile(createPathNode()),
+		ErrHandler: http.HandlerFunc(errHandler),
+	}
+}
+
+// Handle registers a handler for specified host pattern
+//
+// A label of pattern can be wildcard ("*") or named variables, just like
+// PathMux. Variables are captured from right to left, and {name...} must be
+// the first label:
+//
+//    m.Handle("example.com", site)
+//    m.Handle("{tenant}.example.com", tenants)  // GetPathParam(ctx, "tenant")
+//    m.Handle("{sub...}.example.org", fallback) // a.b.example.org => "a.b"
+//
+// Captured variables are kept in context for PathMux handling the request.
+//
+// It panics if pattern is invalid.
+//
+// This method is not thread-safe.
+func (m *HostMux) Handle(pattern string, h http.Handler) {
+	arr := splitLabels(strings.TrimSuffix(pattern, "."))
+	for x, label := range arr {
+		if label == "" {
+			panic(errors.New("mux: host pattern cannot have empty label"))
+		}
+		if !strings.HasPrefix(label, "{") {
+			arr[x] = strings.ToLower(label)
+		}
+	}
+
+	reverseStrings(arr)
+	m.hosts.register("*", "", "/"+strings.Join(arr, "/"), &route{h: h})
+	m.radix = compile(m.hosts)
+}
+
+// HandleFunc registers a handler function for specified host pattern
+//
+// It panics if pattern is invalid.
+//
+// This method is not thread-safe.
+func (m *HostMux) HandleFunc(pattern string, h func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(h))
+}
+
+// ServeHTTP finds correct handler and executes it, or use HostMux.ErrHandler if no match
+func (m *HostMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s := getState()
+	s.setSegments(reverseStrings(strings.Split(hostname(r.Host), ".")))
+	leaf := m.radix.match(s, 0, "")
+	if leaf == nil {
+		s.release()
+		m.ErrHandler.ServeHTTP(w, r)
+		return
+	}
+
+	rt := leaf.node.route("")
+	data := append([]string{}, s.data...)
+	s.release()
+	for x, v := range data {
+		// labels captured by {name...} are joined with "/"
+		if strings.Contains(v, "/") {
+			data[x] = strings.Join(reverseStrings(strings.Split(v, "/")), ".")
+		}
+	}
+	names := reverseStrings(append([]string{}, rt.names...))
+	reverseStrings(data)
+
+	ctx := newVarsContext(r.Context(), names, data)
+	ctx.mounted = true
+	rt.h.ServeHTTP(w, ctx.withRequest(r))
+}
+
+// HeaderMux is a http.Handler dispatches by value of a header, like API version
+//
+//    m := ByHeader("X-API-Version")
+//    m.Handle("1", v1)
+//    m.Handle("2", v2)
+//    m.Handle("", v2) // header is missing
+//    mux.Mount("/api", m)
+type HeaderMux struct {
+	handlers map[string]http.Handler
+	// Header is name of the header
+	Header string
+	// Extract converts header value to the value used to find handler,
+	// default to strings.TrimSpace. See MediaTypeParam.
+	Extract func(string) string
+	// ErrHandler is used if no value matches
+	ErrHandler http.Handler
+}
+
+// ByHeader creates a new HeaderMux with default settings.
+//
+// Error handler returns 404 NOT FOUND.
+func ByHeader(header string) *HeaderMux {
+	return &HeaderMux{
+		handlers:   map[string]http.Handler{},
+		Header:     header,
+		Extract:    strings.TrimSpace,
+		ErrHandler: http.HandlerFunc(errHandler),
+	}
+}
+
+// Handle registers a handler for specified value, empty value matches requests
+// without the header
+//
+// This method is not thread-safe.
+func (m *HeaderMux) Handle(value string, h http.Handler) {
+	m.handlers[value] = h
+}
+
+// HandleFunc registers a handler function for specified value
+//
+// This method is not thread-safe.
+func (m *HeaderMux) HandleFunc(value string, h func(http.ResponseWriter, *http.Request)) {
+	m.Handle(value, http.HandlerFunc(h))
+}
+
+// ServeHTTP finds correct handler and executes it, or use HeaderMux.ErrHandler if no match
+func (m *HeaderMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := m.handlers[m.Extract(r.Header.Get(m.Header))]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	m.ErrHandler.ServeHTTP(w, r)
+}
+
+// MediaTypeParam creates an extractor for HeaderMux, which finds the parameter
+// in media types like Accept header
+//
+//    m := ByHeader("Accept")
+//    m.Extract = MediaTypeParam("version") // "application/json; version=2" => "2"
+func MediaTypeParam(name string) func(string) string {
+	return func(v string) string {
+		for _, item := range strings.Split(v, ",") {
+			_, params, err := mime.ParseMediaType(item)
+			if err != nil {
+				continue
+			}
+			if ret, ok := params[name]; ok {
+				return ret
+			}
+		}
+
+		return ""
+	}
+}
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHostMux(t *testing.T) {
+	var got string
+	var params Params
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			got = name
+			params, _ = GetPathParams(r.Context())
+		}
+	}
+
+	m := ByHost()
+	m.Handle("Example.com", handler("site"))
+	m.Handle("{tenant}.example.com", handler("tenant"))
+	m.Handle("api.example.com", handler("api"))
+	m.Handle("{sub...}.example.org", handler("org"))
+	m.Handle("{id:int}.*.example.net", handler("net"))
+
+	cases := []struct {
+		host   string
+		expect string
+		params Params
+	}{
+		{"example.com", "site", nil},
+		{"EXAMPLE.com:8080", "site", nil},
+		{"example.com.", "site", nil},
+		{"api.example.com", "api", nil},
+		{"foo.example.com", "tenant", Params{{"tenant", "foo"}}},
+		{"a.b.example.org", "org", Params{{"sub", "a.b"}}},
+		{"1.b.example.net", "net", Params{{"id", "1"}}},
+		{"a.b.example.net", "", nil},
+		{"a.b.example.com", "", nil},
+		{"localhost", "", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.host, func(t *testing.T) {
+			got, params = "", nil
+			req := makeReq("http://localhost/")
+			req.Host = c.host
+			m.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != c.expect {
+				t.Errorf("expected handler '%s', got '%s'", c.expect, got)
+			}
+			if !reflect.DeepEqual(params, c.params) {
+				t.Errorf("expected params %#v, got %#v", c.params, params)
+			}
+		})
+	}
+}
+
+func TestHostMuxWithPathMux(t *testing.T) {
+	var data []string
+	var params Params
+	p := ByPath()
+	p.HandleFunc("/x.y/user/{id}", func(w http.ResponseWriter, r *http.Request) {
+		data, _ = GetPathVariable(r.Context())
+		params, _ = GetPathParams(r.Context())
+	})
+	m := ByHost()
+	m.Handle("{tenant}.*.example.com", p)
+
+	req := makeReq("http://localhost/x.y/user/1")
+	req.Host = "foo.bar.example.com"
+	m.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !reflect.DeepEqual(data, []string{"foo", "bar", "1"}) {
+		t.Errorf("unexpected variables: %#v", data)
+	}
+	expect := Params{{"tenant", "foo"}, {"id", "1"}}
+	if !reflect.DeepEqual(params, expect) {
+		t.Errorf("expected params %#v, got %#v", expect, params)
+	}
+}
+
+func TestHostMuxInvalid(t *testing.T) {
+	for _, c := range []string{"", "a..com", "{a", "*.{path...}.com"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected %s to panic", c)
+				}
+			}()
+			ByHost().HandleFunc(c, h)
+		}()
+	}
+}
+
+func TestHeaderMux(t *testing.T) {
+	var got string
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			got = name
+		}
+	}
+
+	version := ByHeader("X-API-Version")
+	version.Handle("1", handler("v1"))
+	version.Handle("2", handler("v2"))
+	version.Handle("", handler("default"))
+
+	accept := ByHeader("Accept")
+	accept.Extract = MediaTypeParam("version")
+	accept.Handle("2", handler("accept v2"))
+
+	cases := []struct {
+		name   string
+		m      http.Handler
+		header string
+		value  string
+		expect string
+		code   int
+	}{
+		{"Version", version, "X-API-Version", " 1 ", "v1", 200},
+		{"Version2", version, "X-API-Version", "2", "v2", 200},
+		{"Missing", version, "", "", "default", 200},
+		{"Unknown", version, "X-API-Version", "3", "", 404},
+		{"Accept", accept, "Accept", "text/html, application/json; version=2", "accept v2", 200},
+		{"AcceptUnknown", accept, "Accept", "application/json", "", 404},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got = ""
+			req := makeReq("http://localhost/")
+			req.Header = http.Header{}
+			if c.header != "" {
+				req.Header.Set(c.header, c.value)
+			}
+			w := httptest.NewRecorder()
+			c.m.ServeHTTP(w, req)
+
+			if got != c.expect {
+				t.Errorf("expected handler '%s', got '%s'", c.expect, got)
+			}
+			if w.Code != c.code {
+				t.Errorf("expected status %d, got %d", c.code, w.Code)
+			}
+		})
+	}
+}
@@ -4,13 +4,68 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // ContextKey represents a key used in context
 type ContextKey string
 
-const PathVarKey = ContextKey("pathData")
+const (
+	// PathVarKey holds all captured path variables as []string, by position
+	PathVarKey = ContextKey("pathData")
+	// PathParamKey holds named path variables as Params
+	PathParamKey = ContextKey("pathParams")
+)
+
+// Param is a named path variable
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Params is named path variables of matched route, in order of appearance
+type Params []Param
+
+// Get returns value of named variable
+func (p Params) Get(name string) (value string, ok bool) {
+	for _, v := range p {
+		if v.Name == name {
+			return v.Value, true
+		}
+	}
+
+	return
+}
+
+// GetPathParams extracts named variables from context
+func GetPathParams(c context.Context) (params Params, ok bool) {
+	v := c.Value(PathParamKey)
+	if v == nil {
+		return
+	}
+
+	params, ok = v.(Params)
+	return
+}
+
+// GetPathParam extracts a named variable from context
+//
+// Say we have a pattern /user/{id:int}/posts/{slug}
+//
+//    id, _ := GetPathParam(request.Context(), "id")
+//    slug, _ := GetPathParam(request.Context(), "slug")
+func GetPathParam(c context.Context, name string) (value string, ok bool) {
+	params, ok := GetPathParams(c)
+	if !ok {
+		return
+	}
+
+	return params.Get(name)
+}
 
 // GetPathVariable extracts variables from context
 func GetPathVariable(c context.Context) (data []string, ok bool) {
@@ -52,101 +107,448 @@ func FillPathVariable(c context.Context, vars ...*string) int {
 	return min
 }
 
+// paramTypes are predefined constraints of typed path variables, they are
+// identical to commented regular expressions but faster
+var paramTypes = map[string]func(string) bool{
+	"int":   isInt,   // -?[0-9]+
+	"uint":  isUint,  // [0-9]+
+	"hex":   isHex,   // [0-9a-fA-F]+
+	"alpha": isAlpha, // [a-zA-Z]+
+	"uuid":  isUUID,  // [0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}
+}
+
+// all reports whether s is not empty and every byte of s satisfies f
+func all(s string, f func(c byte) bool) bool {
+	if s == "" {
+		return false
+	}
+	for x := 0; x < len(s); x++ {
+		if !f(s[x]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isInt(s string) bool {
+	return isUint(strings.TrimPrefix(s, "-"))
+}
+
+func isUint(s string) bool {
+	return all(s, isDigit)
+}
+
+func isHex(s string) bool {
+	return all(s, isHexDigit)
+}
+
+func isAlpha(s string) bool {
+	return all(s, isLetter)
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return false
+	}
+
+	return isHex(s[:8]) && isHex(s[9:13]) && isHex(s[14:18]) &&
+		isHex(s[19:23]) && isHex(s[24:])
+}
+
+// parseParam parses a path segment like {name}, {name:constraint}, {name...}
+// or {...}, ok is false if seg is not a variable
+func parseParam(seg string) (name, constraint string, rest, ok bool) {
+	if !strings.HasPrefix(seg, "{") {
+		if strings.ContainsAny(seg, "{}") {
+			panic("router: variable must be whole segment: " + seg)
+		}
+		return
+	}
+	if !strings.HasSuffix(seg, "}") {
+		panic("router: variable must be whole segment: " + seg)
+	}
+
+	name = seg[1 : len(seg)-1]
+	if idx := strings.Index(name, ":"); idx != -1 {
+		name, constraint = name[:idx], name[idx+1:]
+		if constraint == "" {
+			panic("router: empty constraint: " + seg)
+		}
+	} else if strings.HasSuffix(name, "...") {
+		name, rest = strings.TrimSuffix(name, "..."), true
+	}
+	if name == "" && !rest {
+		panic("router: variable must have a name: " + seg)
+	}
+	if strings.ContainsAny(name, "{}") {
+		panic("router: invalid variable name: " + seg)
+	}
+
+	return name, constraint, rest, true
+}
+
+// paramNode is a child of pathNode which matches a segment by constraint
+type paramNode struct {
+	constraint string
+	match      func(string) bool
+	node       *pathNode
+}
+
+// compileConstraint compiles predefined type or regular expression
+func compileConstraint(constraint string) func(string) bool {
+	if f, ok := paramTypes[constraint]; ok {
+		return f
+	}
+
+	re, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		panic("router: invalid constraint " + constraint + ": " + err.Error())
+	}
+
+	return re.MatchString
+}
+
+// route is a handler registered to pathNode
+type route struct {
+	h       http.Handler
+	pattern string   // path as registered
+	names   []string // name of each variable, "" for wildcard
+	mount   bool     // strips matched prefix, see PathMux.Mount
+}
+
+// namedParams pairs names of the route with captured variables
+func (rt *route) namedParams(data []string) Params {
+	return namedParams(rt.names, data)
+}
+
+// namedParams pairs names with variables, skipping those without name
+func namedParams(names, data []string) Params {
+	ret := make(Params, 0, len(names))
+	for idx, name := range names {
+		if name != "" && idx < len(data) {
+			ret = append(ret, Param{Name: name, Value: data[idx]})
+		}
+	}
+
+	return ret
+}
+
 // pathNode is an element in mapping tree, dispatching by path
 //
-// A pathNode can contains mappings to child pathNode and a handler
+// A pathNode can contains mappings to child pathNode and handlers. Typed
+// variables are tried in order of registration, after static children and
+// before wildcard.
 type pathNode struct {
 	child    map[string]*pathNode
+	params   []*paramNode
 	catchAll *pathNode
-	h        http.Handler
+	rest     *pathNode         // {name...}, matches all remaining segments
+	routes   map[string]*route // by method, "" matches any method
 }
 
 func createPathNode() *pathNode {
 	return &pathNode{child: map[string]*pathNode{}}
 }
 
-// Go idiom
-func (n *pathNode) match(r *http.Request) (h http.Handler, data []string, found bool) {
-	arr := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	return n.doMatch(arr, make([]string, 0, len(arr)))
+// route finds handler for the method, "" matches any handler
+func (n *pathNode) route(method string) *route {
+	if len(n.routes) == 0 {
+		return nil
+	}
+	if method == "" {
+		for _, rt := range n.routes {
+			return rt
+		}
+	}
+
+	if rt, ok := n.routes[method]; ok {
+		return rt
+	}
+	if rt, ok := n.routes[""]; ok {
+		return rt
+	}
+	if method == http.MethodHead {
+		return n.routes[http.MethodGet]
+	}
+
+	return nil
 }
 
-func (n *pathNode) doMatch(arr []string, oldData []string) (h http.Handler, data []string, found bool) {
-	data = oldData
-	if len(arr) < 1 {
-		if n.h != nil {
-			return n.h, oldData, true
+// methods lists methods accepted by this node, for Allow header
+func (n *pathNode) methods() []string {
+	ret := []string{http.MethodOptions}
+	for m := range n.routes {
+		ret = append(ret, m)
+		if m == http.MethodGet && n.routes[http.MethodHead] == nil {
+			ret = append(ret, http.MethodHead)
 		}
-		return
 	}
+	sort.Strings(ret)
 
-	cur := arr[0]
-	if cur != "" {
-		if next, ok := n.child[cur]; ok {
-			if h, data, found = next.doMatch(arr[1:], oldData); found {
-				return
+	return ret
+}
+
+// patternSeg is a parsed segment of pattern
+type patternSeg struct {
+	raw        string
+	name       string // name of variable, "" for wildcard
+	constraint string
+	match      func(string) bool // compiled constraint, only set by parsePattern
+	rest       bool
+	variable   bool // named variable or wildcard
+}
+
+func toSeg(wild, raw string) patternSeg {
+	name, constraint, rest, ok := parseParam(raw)
+	return patternSeg{
+		raw:        raw,
+		name:       name,
+		constraint: constraint,
+		rest:       rest,
+		variable:   ok || raw == wild,
+	}
+}
+
+// parsePattern splits and validates pattern before modifying the tree, so the
+// tree is unchanged if it panics. names are names of variables, "" for
+// wildcard.
+func parsePattern(wild, pattern string) (segs []patternSeg, names []string) {
+	arr := strings.Split(strings.TrimLeft(pattern, "/"), "/")
+	segs = make([]patternSeg, 0, len(arr))
+	names = make([]string, 0, strings.Count(pattern, "{")+strings.Count(pattern, wild))
+	for x, cur := range arr {
+		seg := toSeg(wild, cur)
+		if seg.variable && cur != wild {
+			for _, name := range names {
+				if name != "" && name == seg.name {
+					panic("router: duplicated variable name: " + name)
+				}
+			}
+			if seg.rest && x != len(arr)-1 {
+				panic("router: " + cur + " must be the last segment")
+			}
+		} else {
+			if strings.Index(cur, wild) != -1 && cur != wild {
+				panic("router: wildcard cannot use with others")
+			}
+			if x != len(arr)-1 && cur == "" {
+				panic("router: pattern cannot have empty string")
 			}
 		}
 
-		if n.catchAll != nil {
-			tmpData := oldData
-			l := len(tmpData)
-			tmpData = append(tmpData, "")
-			if h, data, found = n.catchAll.doMatch(arr[1:], tmpData); found {
-				data[l] = cur
-				return
-			}
-			data = oldData
+		if seg.variable {
+			names = append(names, seg.name)
+		}
+		if seg.constraint != "" {
+			seg.match = compileConstraint(seg.constraint)
 		}
+		segs = append(segs, seg)
 	}
 
-	if next, ok := n.child[""]; ok {
-		return next.h, data, true
+	return
+}
+
+// register adds the route to the tree, n is not modified if pattern is invalid
+// or conflicts with another pattern, like "/{a}" and "/*"
+func (n *pathNode) register(wild, method, pattern string, rt *route) {
+	segs, names := parsePattern(wild, pattern)
+	if old := n.lookup(segs, method); old != nil && old.pattern != pattern {
+		panic("router: " + pattern + " conflicts with " + old.pattern)
 	}
 
-	return
+	rt.pattern = pattern
+	rt.names = names
+	for _, seg := range segs {
+		n = n.walk(seg, true)
+	}
+
+	if n.routes == nil {
+		n.routes = map[string]*route{}
+	}
+	n.routes[method] = rt
+}
+
+// lookup finds the route registered to the node of segs for exactly method
+func (n *pathNode) lookup(segs []patternSeg, method string) *route {
+	for _, seg := range segs {
+		if n = n.walk(seg, false); n == nil {
+			return nil
+		}
+	}
+
+	return n.routes[method]
 }
 
-func (n *pathNode) register(wild, pattern string, h http.Handler) {
+// remove removes the route from the tree, and prunes empty nodes
+func (n *pathNode) remove(wild, method, pattern string) bool {
 	arr := strings.Split(strings.TrimLeft(pattern, "/"), "/")
-	n.doRegister(wild, arr, h)
+	return n.doRemove(wild, method, arr)
 }
 
-func (n *pathNode) doRegister(wild string, arr []string, h http.Handler) {
+func (n *pathNode) doRemove(wild, method string, arr []string) bool {
 	if len(arr) < 1 {
-		n.h = h
-		return
+		if _, ok := n.routes[method]; !ok {
+			return false
+		}
+		delete(n.routes, method)
+		return true
 	}
 
-	cur := arr[0]
-	if strings.Index(cur, wild) != -1 && cur != wild {
-		panic("router: wildcard cannot use with others")
+	seg := toSeg(wild, arr[0])
+	next := n.walk(seg, false)
+	if next == nil || !next.doRemove(wild, method, arr[1:]) {
+		return false
 	}
-	if len(arr) != 1 && cur == "" {
-		panic("router: pattern cannot have empty string")
+	if next.empty() {
+		n.drop(seg)
 	}
-	if cur == wild {
-		if n.catchAll == nil {
+
+	return true
+}
+
+// copy creates a deep copy of the tree, so it can be served while the
+// original one is being modified
+func (n *pathNode) copy() *pathNode {
+	if n == nil {
+		return nil
+	}
+
+	ret := &pathNode{
+		child:    make(map[string]*pathNode, len(n.child)),
+		catchAll: n.catchAll.copy(),
+		rest:     n.rest.copy(),
+	}
+	for k, v := range n.child {
+		ret.child[k] = v.copy()
+	}
+	if len(n.params) > 0 {
+		ret.params = make([]*paramNode, len(n.params))
+		for x, p := range n.params {
+			ret.params[x] = &paramNode{
+				constraint: p.constraint,
+				match:      p.match,
+				node:       p.node.copy(),
+			}
+		}
+	}
+	if n.routes != nil {
+		ret.routes = make(map[string]*route, len(n.routes))
+		for k, v := range n.routes {
+			ret.routes[k] = v
+		}
+	}
+
+	return ret
+}
+
+func (n *pathNode) empty() bool {
+	return len(n.routes) == 0 && len(n.child) == 0 && len(n.params) == 0 &&
+		n.catchAll == nil && n.rest == nil
+}
+
+// walk finds the child for a segment of pattern. Missing child is created if
+// create is true, or nil is returned.
+func (n *pathNode) walk(seg patternSeg, create bool) *pathNode {
+	switch {
+	case seg.rest:
+		if n.rest == nil && create {
+			n.rest = createPathNode()
+		}
+		return n.rest
+	case seg.constraint != "":
+		for _, p := range n.params {
+			if p.constraint == seg.constraint {
+				return p.node
+			}
+		}
+		if !create {
+			return nil
+		}
+		p := &paramNode{
+			constraint: seg.constraint,
+			match:      seg.match,
+			node:       createPathNode(),
+		}
+		n.params = append(n.params, p)
+		return p.node
+	case seg.variable:
+		if n.catchAll == nil && create {
 			n.catchAll = createPathNode()
 		}
-		n.catchAll.doRegister(wild, arr[1:], h)
-		return
+		return n.catchAll
 	}
 
-	next, ok := n.child[cur]
-	if !ok {
+	next := n.child[seg.raw]
+	if next == nil && create {
 		next = createPathNode()
-		n.child[cur] = next
+		n.child[seg.raw] = next
 	}
+	return next
+}
 
-	next.doRegister(wild, arr[1:], h)
+// drop removes the child for a segment of pattern
+func (n *pathNode) drop(seg patternSeg) {
+	switch {
+	case seg.rest:
+		n.rest = nil
+	case seg.constraint != "":
+		for x, p := range n.params {
+			if p.constraint == seg.constraint {
+				n.params = append(n.params[:x], n.params[x+1:]...)
+				return
+			}
+		}
+	case seg.variable:
+		n.catchAll = nil
+	default:
+		delete(n.child, seg.raw)
+	}
 }
 
 // PathMux is a http.ServerMux compitable mux implementation, dispatches by path
+//
+// Routes can be registered or removed at any time, even when serving requests.
+// Other fields should be set before serving.
 type PathMux struct {
-	mappings   *pathNode
+	lock       sync.Mutex   // protects build
+	build      *routeTable  // routes being modified, see update
+	dirty      atomic.Bool  // build is changed since last snapshot
+	tab        atomic.Value // *routeTable, snapshot being served
 	Wildcard   string
 	ErrHandler http.Handler
+	// MethodNotAllowedHandler is used if path matches but method does not,
+	// Allow header is set before calling it
+	MethodNotAllowedHandler http.Handler
+
+	// CleanPath redirects requests to cleaned path, like "/a/../b//c" to
+	// "/b/c", if cleaned path matches a route
+	CleanPath bool
+	// TrailingSlash decides whether to redirect requests to path with or
+	// without trailing slash, if the path matches a route. Handlers
+	// registered by Mount are not affected.
+	TrailingSlash SlashPolicy
+	// CaseInsensitive redirects requests to the path as registered, if it
+	// matches a route only case-insensitively
+	CaseInsensitive bool
+	// RedirectCode is status code of redirecting to canonical path. Default
+	// to 301 for GET and HEAD requests, 308 for others.
+	RedirectCode int
+	// UseRawPath matches against URL.RawPath if present, so encoded slash
+	// ("%2F") is part of a segment instead of a separator
+	UseRawPath bool
 }
 
 func errHandler(w http.ResponseWriter, r *http.Request) {
@@ -154,45 +556,250 @@ func errHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
+
 // ByPath creates a new PathMux with default settings.
 //
-// Wildcard defaults to "*". Error handler returns 404 NOT FOUND for every error.
+// Wildcard defaults to "*". Error handler returns 404 NOT FOUND for every error,
+// and MethodNotAllowedHandler returns 405 METHOD NOT ALLOWED.
 func ByPath() *PathMux {
-	return &PathMux{
-		mappings:   createPathNode(),
-		Wildcard:   "*",
-		ErrHandler: http.HandlerFunc(errHandler),
+	ret := &PathMux{
+		Wildcard:                "*",
+		ErrHandler:              http.HandlerFunc(errHandler),
+		MethodNotAllowedHandler: http.HandlerFunc(methodNotAllowedHandler),
+	}
+	ret.build = &routeTable{
+		mappings: createPathNode(),
+		names:    map[string]*namedRoute{},
+		index:    map[routeKey]int{},
 	}
+	ret.tab.Store(ret.build.snapshot())
+
+	return ret
+}
+
+// splitMethod splits pattern like "GET /path" into method and path
+func splitMethod(pattern string) (method, path string) {
+	idx := strings.Index(pattern, " ")
+	if idx == -1 {
+		return "", pattern
+	}
+
+	return pattern[:idx], strings.TrimLeft(pattern[idx+1:], " ")
 }
 
 // Handle registers a handler for specified pattern
 //
-// It panics if pattern is invalid.
+// Pattern can be prefixed with a method like "GET /user/*", so the handler
+// accepts only that method; without it, handler accepts any method. GET handler
+// also accepts HEAD requests. If path matches but method does not, OPTIONS
+// requests are answered with 204 NO CONTENT, others are passed to
+// MethodNotAllowedHandler. Both have Allow header set.
 //
-// This method is not thread-safe.
+// Besides wildcard, a segment can be a named variable, which can be retrieved
+// by GetPathParam:
+//
+//    {name}        any segment, like wildcard
+//    {name:int}    segment matching predefined type: int, uint, hex, alpha or uuid
+//    {name:[a-z]+} segment matching the regular expression, cannot contain "/"
+//    {name...}     all remaining segments, must be the last one
+//    {...}         same as above, but anonymous
+//
+// Static segments take precedence over typed variables, which take precedence
+// over wildcard and untyped variables. Named variables are also available in
+// GetPathVariable, by position.
+//
+// It panics if pattern is invalid, or it matches same paths as another pattern
+// of the method, like "/a/{id}" and "/a/*". Registering same pattern again
+// replaces the handler.
+//
+// This method is thread-safe.
 func (m *PathMux) Handle(pattern string, h http.Handler) {
-	if !strings.HasPrefix(pattern, "/") {
+	m.handle("", pattern, h)
+}
+
+func (m *PathMux) handle(name, pattern string, h http.Handler) {
+	method, path := splitMethod(pattern)
+	if !strings.HasPrefix(path, "/") || (method == "" && path != pattern) {
 		panic(errors.New("mux: pattern must begin with /"))
 	}
+	path = cleanPattern(path)
+
+	m.update(func(t *routeTable) {
+		if old, ok := t.names[name]; ok && (old.Method != method || old.Pattern != path) {
+			panic(errors.New("mux: duplicated route name: " + name))
+		}
+
+		t.mappings.register(m.Wildcard, method, path, &route{h: h})
+		t.record(name, method, path, m.Wildcard)
+	})
+}
+
+// Mount registers a handler for all paths under prefix, like another PathMux
+//
+// The handler receives a request with prefix stripped from URL.Path, and
+// variables captured in prefix are kept in context for mounted PathMux.
+//
+//    api := ByPath()
+//    api.HandleFunc("GET /user/{id}", showUser)
+//    m.Mount("/api/{version}", api) // GET /api/v1/user/1 reaches showUser
+//
+// It panics if prefix is invalid.
+//
+// This method is thread-safe.
+func (m *PathMux) Mount(prefix string, h http.Handler) {
+	pattern := mountPattern(prefix)
+	m.update(func(t *routeTable) {
+		t.mappings.register(m.Wildcard, "", pattern, &route{h: h, mount: true})
+		t.record("", "", pattern, m.Wildcard)
+	})
+}
+
+// mountPattern converts prefix to the pattern used by Mount
+func mountPattern(prefix string) string {
+	if !strings.HasPrefix(prefix, "/") {
+		panic(errors.New("mux: prefix must begin with /"))
+	}
+
+	return cleanPattern(strings.TrimRight(prefix, "/") + "/{...}")
+}
 
-	m.mappings.register(m.Wildcard, pattern, h)
+// cleanPattern removes redundant leading slashes, which are ignored when
+// matching, so equivalent patterns are recorded as same route
+func cleanPattern(path string) string {
+	return "/" + strings.TrimLeft(path, "/")
 }
 
 // HandleFunc registers a handler function for specified pattern
 //
 // It panics if pattern is invalid.
 //
-// This method is not thread-safe.
+// This method is thread-safe.
 func (m *PathMux) HandleFunc(pattern string, h func(http.ResponseWriter, *http.Request)) {
 	m.Handle(pattern, http.HandlerFunc(h))
 }
 
 // ServeHTTP finds correct handler and executes it, or use PathMux.ErrHandler if no match
 func (m *PathMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h, data, found := m.mappings.match(r); found {
-		req := r.WithContext(context.WithValue(r.Context(), PathVarKey, data))
-		h.ServeHTTP(w, req)
+	t := m.table()
+	if target := m.canonical(t, r); target != "" {
+		m.redirect(w, r, target)
+		return
+	}
+
+	s := getState()
+	m.split(s, r)
+	root := t.compiled()
+	if leaf := root.match(s, 0, r.Method); leaf != nil {
+		m.serve(w, r, leaf.node.route(r.Method), s)
+		return
+	}
+
+	s.data = s.data[:0]
+	leaf := root.match(s, 0, "")
+	s.release()
+	if leaf != nil {
+		w.Header().Set("Allow", strings.Join(leaf.node.methods(), ", "))
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		m.MethodNotAllowedHandler.ServeHTTP(w, r)
 		return
 	}
 	m.ErrHandler.ServeHTTP(w, r)
 }
+
+// mountKey marks the request is passed to a mounted handler, or another
+// handler of this package, so variables captured by outer router are kept
+type mountKey struct{}
+
+// varsContext carries path variables, it holds the request carrying itself so
+// only one object is allocated for each request
+type varsContext struct {
+	context.Context
+	data    []string
+	names   []string // names of data, not used if params is set
+	params  Params   // variables merged with outer router
+	mounted bool
+	buf     [4]string
+	req     http.Request // request carrying this context, see withRequest
+}
+
+// withRequest returns a copy of r carrying c, the copy is stored in c
+func (c *varsContext) withRequest(r *http.Request) *http.Request {
+	c.req = *r.WithContext(c)
+	return &c.req
+}
+
+// newVarsContext copies variables into a new context, appending to variables
+// captured by outer router
+func newVarsContext(parent context.Context, names, data []string) *varsContext {
+	c := &varsContext{Context: parent}
+	if parent.Value(mountKey{}) == nil {
+		c.data = append(c.buf[:0], data...)
+		c.names = names
+		return c
+	}
+
+	pdata, _ := GetPathVariable(parent)
+	pparams, _ := GetPathParams(parent)
+	c.data = append(append(make([]string, 0, len(pdata)+len(data)), pdata...), data...)
+	c.params = append(append(Params{}, pparams...), namedParams(names, data)...)
+	c.mounted = true
+	return c
+}
+
+func (c *varsContext) Value(key interface{}) interface{} {
+	switch key {
+	case PathVarKey:
+		return c.data
+	case PathParamKey:
+		if c.params != nil {
+			if len(c.params) > 0 {
+				return c.params
+			}
+			break
+		}
+		if ret := namedParams(c.names, c.data); len(ret) > 0 {
+			return ret
+		}
+	case mountKey{}:
+		if c.mounted {
+			return true
+		}
+	}
+
+	return c.Context.Value(key)
+}
+
+// serve executes the route with path variables in context, s is released
+func (m *PathMux) serve(w http.ResponseWriter, r *http.Request, rt *route, s *matchState) {
+	data, names := s.data, rt.names
+	var rest string
+	if rt.mount {
+		rest = data[len(data)-1]
+		data, names = data[:len(data)-1], names[:len(names)-1]
+	}
+	ctx := newVarsContext(r.Context(), names, data)
+	s.release()
+
+	if !rt.mount {
+		rt.h.ServeHTTP(w, ctx.withRequest(r))
+		return
+	}
+
+	ctx.mounted = true
+	req := ctx.withRequest(r)
+	u := *r.URL
+	u.Path = "/" + rest
+	if rest != "" && strings.HasSuffix(r.URL.Path, "/") {
+		// keep trailing slash for handlers like FileServer
+		u.Path += "/"
+	}
+	u.RawPath = ""
+	req.URL = &u
+	rt.h.ServeHTTP(w, req)
+}
@@ -3,6 +3,8 @@ package router
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 )
@@ -17,9 +19,13 @@ func TestPathMuxRegister(t *testing.T) {
 		"/a/*",
 		"/*/a",
 		"//a/*",
+		"GET /a",
+		"POST /a/*",
 	}
 	failedCases := []string{
 		"a",
+		" /a",
+		"GET a",
 		"/a*/a",
 		"/a/*a",
 		"/a//*",
@@ -256,7 +262,7 @@ func TestPathMuxMatching(t *testing.T) {
 			m := ByPath()
 			m.HandleFunc(c.rule, h)
 			req := makeReq(c.uri)
-			_, data, found := m.mappings.match(req)
+			_, data, found := m.table().match(req)
 			if found != c.found {
 				t.Fatalf("expected matching [%s] with rule [%s] to be %t, got %t", c.uri, c.rule, c.found, found)
 			}
@@ -273,7 +279,7 @@ func TestPathMuxCustomWildcard(t *testing.T) {
 	m.Wildcard = "wild"
 	m.HandleFunc("/a/wild/b", h)
 	req := makeReq("http://localhost/a/c/b")
-	_, data, found := m.mappings.match(req)
+	_, data, found := m.table().match(req)
 	if !found {
 		t.Fatal("expected to match, but not")
 	}
@@ -318,3 +324,281 @@ func TestFillPathVars(t *testing.T) {
 		}
 	})
 }
+
+func TestPathMuxRegisterParams(t *testing.T) {
+	successCases := []string{
+		"/{id}",
+		"/a/{id}/b",
+		"/a/{id:int}",
+		"/a/{id:[0-9]{3}}",
+		"/a/{id:.*}",
+		"/a/{path...}",
+		"/{a}/{b:uuid}/{c...}",
+	}
+	failedCases := []string{
+		"/a{id}",
+		"/a/{id}b",
+		"/a/{id",
+		"/a/{}",
+		"/a/{:int}",
+		"/a/{id:}",
+		"/a/{id:[0-9}",
+		"/a/{id}/{id}",
+		"/a/{id}/*/{id:int}",
+		"/a/{path...}/b",
+		"/a/{a}.{b}",
+	}
+
+	m := ByPath()
+	for _, c := range successCases {
+		t.Run("Valid", func(t *testing.T) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+
+				t.Errorf("unexpected failure for %s: %s", c, err)
+			}()
+			m.HandleFunc(c, h)
+		})
+	}
+	for _, c := range failedCases {
+		t.Run("Invalid", func(t *testing.T) {
+			defer func() {
+				err := recover()
+				if err != nil {
+					return
+				}
+
+				t.Errorf("unexpected success for %s", c)
+			}()
+			m.HandleFunc(c, h)
+		})
+	}
+}
+
+func TestPathMuxMatchingParams(t *testing.T) {
+	cases := []struct {
+		rule   string
+		uri    string
+		data   []string
+		params Params
+		found  bool
+	}{
+		{
+			rule:   "/user/{id}/posts/{slug}",
+			uri:    "http://localhost/user/1/posts/hello",
+			data:   []string{"1", "hello"},
+			params: Params{{"id", "1"}, {"slug", "hello"}},
+			found:  true,
+		},
+		{
+			rule:  "/user/{id}/posts/{slug}",
+			uri:   "http://localhost/user/1/posts",
+			found: false,
+		},
+		{
+			rule:   "/user/{id:int}",
+			uri:    "http://localhost/user/-12",
+			data:   []string{"-12"},
+			params: Params{{"id", "-12"}},
+			found:  true,
+		},
+		{
+			rule:  "/user/{id:int}",
+			uri:   "http://localhost/user/abc",
+			found: false,
+		},
+		{
+			rule:  "/user/{id:uint}",
+			uri:   "http://localhost/user/-12",
+			found: false,
+		},
+		{
+			rule:   "/user/{id:[a-c]+}",
+			uri:    "http://localhost/user/abc",
+			data:   []string{"abc"},
+			params: Params{{"id", "abc"}},
+			found:  true,
+		},
+		{
+			rule:  "/user/{id:[a-c]+}",
+			uri:   "http://localhost/user/abcd",
+			found: false,
+		},
+		{
+			rule:   "/*/{name}",
+			uri:    "http://localhost/a/b",
+			data:   []string{"a", "b"},
+			params: Params{{"name", "b"}},
+			found:  true,
+		},
+		{
+			rule:   "/static/{path...}",
+			uri:    "http://localhost/static/js/app.js",
+			data:   []string{"js/app.js"},
+			params: Params{{"path", "js/app.js"}},
+			found:  true,
+		},
+		{
+			rule:   "/static/{path...}",
+			uri:    "http://localhost/static",
+			data:   []string{""},
+			params: Params{{"path", ""}},
+			found:  true,
+		},
+		{
+			rule:  "/static/{path...}",
+			uri:   "http://localhost/",
+			found: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Matching[%s][%s]", c.rule, c.uri), func(t *testing.T) {
+			m := ByPath()
+			m.HandleFunc(c.rule, h)
+			req := makeReq(c.uri)
+			rt, data, found := m.table().match(req)
+			if found != c.found {
+				t.Fatalf("expected matching [%s] with rule [%s] to be %t, got %t", c.uri, c.rule, c.found, found)
+			}
+			if !found {
+				return
+			}
+
+			if !reflect.DeepEqual(data, c.data) {
+				t.Fatalf("expected variables are %#v, got %#v", c.data, data)
+			}
+			if params := rt.namedParams(data); !reflect.DeepEqual(params, c.params) {
+				t.Fatalf("expected params are %#v, got %#v", c.params, params)
+			}
+		})
+	}
+}
+
+func TestPathMuxParamsPriority(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("/user/me", h)
+	m.HandleFunc("/user/{id:int}", h)
+	m.HandleFunc("/user/{name}", h)
+	m.HandleFunc("/user/{name}/{rest...}", h)
+
+	cases := []struct {
+		uri    string
+		params Params
+	}{
+		{"http://localhost/user/me", Params{}},
+		{"http://localhost/user/1", Params{{"id", "1"}}},
+		{"http://localhost/user/ronmi", Params{{"name", "ronmi"}}},
+		{"http://localhost/user/ronmi/a/b", Params{{"name", "ronmi"}, {"rest", "a/b"}}},
+	}
+
+	for _, c := range cases {
+		rt, data, found := m.table().match(makeReq(c.uri))
+		if !found {
+			t.Fatalf("expected %s to match, but not", c.uri)
+		}
+		if params := rt.namedParams(data); !reflect.DeepEqual(params, c.params) {
+			t.Errorf("%s: expected params are %#v, got %#v", c.uri, c.params, params)
+		}
+	}
+}
+
+func TestGetPathParam(t *testing.T) {
+	var id, slug string
+	var ok bool
+	m := ByPath()
+	m.HandleFunc("/user/{id:int}/posts/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok = GetPathParam(r.Context(), "id")
+		slug, _ = GetPathParam(r.Context(), "slug")
+	})
+
+	m.ServeHTTP(httptest.NewRecorder(), makeReq("http://localhost/user/1/posts/hello"))
+	if !ok {
+		t.Fatal("expected to get id, but not")
+	}
+	if id != "1" {
+		t.Errorf("expected id to be '1', got '%s'", id)
+	}
+	if slug != "hello" {
+		t.Errorf("expected slug to be 'hello', got '%s'", slug)
+	}
+
+	if _, ok := GetPathParam(context.Background(), "id"); ok {
+		t.Error("expected to get nothing from empty context")
+	}
+}
+
+func TestPathMuxMethod(t *testing.T) {
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}
+	}
+	m := ByPath()
+	m.Handle("GET /user/{id}", handler("get"))
+	m.Handle("POST /user/{id}", handler("post"))
+	m.Handle("DELETE /user/me", handler("delete me"))
+	m.Handle("/any", handler("any"))
+	m.Handle("PUT /any", handler("put any"))
+
+	cases := []struct {
+		method string
+		uri    string
+		code   int
+		body   string
+		allow  string
+	}{
+		{"GET", "http://localhost/user/1", 200, "get", ""},
+		{"HEAD", "http://localhost/user/1", 200, "get", ""},
+		{"POST", "http://localhost/user/1", 200, "post", ""},
+		{"POST", "http://localhost/user/me", 200, "post", ""},
+		{"DELETE", "http://localhost/user/me", 200, "delete me", ""},
+		{"DELETE", "http://localhost/user/1", 405, "", "GET, HEAD, OPTIONS, POST"},
+		{"OPTIONS", "http://localhost/user/1", 204, "", "GET, HEAD, OPTIONS, POST"},
+		{"PATCH", "http://localhost/any", 200, "any", ""},
+		{"PUT", "http://localhost/any", 200, "put any", ""},
+		{"GET", "http://localhost/none", 404, "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.method+" "+c.uri, func(t *testing.T) {
+			req := makeReq(c.uri)
+			req.Method = c.method
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, req)
+
+			if w.Code != c.code {
+				t.Errorf("expected status %d, got %d", c.code, w.Code)
+			}
+			if body := w.Body.String(); body != c.body {
+				t.Errorf("expected body '%s', got '%s'", c.body, body)
+			}
+			if allow := w.Header().Get("Allow"); allow != c.allow {
+				t.Errorf("expected Allow to be '%s', got '%s'", c.allow, allow)
+			}
+		})
+	}
+}
+
+func TestPathMuxMethodNotAllowedHandler(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("GET /a", h)
+	m.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	req := makeReq("http://localhost/a")
+	req.Method = "POST"
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTeapot {
+		t.Errorf("expected custom handler to be called, got status %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("unexpected Allow header: %s", allow)
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 func h(w http.ResponseWriter, r *http.Request) {}
@@ -41,10 +42,19 @@ func createPathRules(n int, var1, var2 string) []string {
 	return routingRules
 }
 
+// nopWriter discards response, so benchmarks measure the router only
+type nopWriter http.Header
+
+func (w nopWriter) Header() http.Header         { return http.Header(w) }
+func (w nopWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w nopWriter) WriteHeader(int)             {}
+
 func benchDispatch(m http.Handler, req *http.Request, b *testing.B) {
+	w := nopWriter{}
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		m.ServeHTTP(httptest.NewRecorder(), req)
+		m.ServeHTTP(w, req)
 	}
 }
 
@@ -127,3 +137,79 @@ func BenchmarkPathMuxDispatch(b *testing.B) {
 		)
 	}
 }
+
+func BenchmarkPathMuxDispatchParams(b *testing.B) {
+	m := ByPath()
+	m.HandleFunc("GET /user/{id:int}", h)
+	m.HandleFunc("GET /user/{id:int}/post/{slug}", h)
+	m.HandleFunc("GET /static/{path...}", h)
+
+	cases := map[string]string{
+		"Typed": "http://localhost/user/42/post/hello",
+		"Rest":  "http://localhost/static/css/site.css",
+	}
+	for name, uri := range cases {
+		b.Run(name, func(b *testing.B) {
+			benchDispatch(m, makeReq(uri), b)
+		})
+	}
+}
+
+func BenchmarkPathMuxCanonical(b *testing.B) {
+	m := createPathMux(1000)
+	m.CleanPath = true
+	m.TrailingSlash = SlashRemove
+	m.CaseInsensitive = true
+
+	cases := map[string]string{
+		"Canonical": "http://localhost/lv1/lv2/500/var1/var2",
+		"Redirect":  "http://localhost/lv1/lv2/500/var1/var2/",
+	}
+	for name, uri := range cases {
+		b.Run(name, func(b *testing.B) {
+			benchDispatch(m, makeReq(uri), b)
+		})
+	}
+}
+
+// BenchmarkCompare dispatches same routes with PathMux, http.ServeMux and
+// httprouter
+//
+// Routes with variables cost PathMux two allocations, a copy of request and
+// the context carrying variables, while httprouter passes them as argument.
+func BenchmarkCompare(b *testing.B) {
+	const n = 1000
+	nop := func(http.ResponseWriter, *http.Request, httprouter.Params) {}
+	pm, sm, hr := createPathMux(n), http.NewServeMux(), httprouter.New()
+	pm.HandleFunc("/lv1/static", h)
+	sm.HandleFunc("/lv1/static", h)
+	hr.GET("/lv1/static", nop)
+	for i := 1; i <= n; i++ {
+		sm.HandleFunc(fmt.Sprintf("/lv1/lv2/%d/{a}/{b}", i), h)
+		hr.GET(fmt.Sprintf("/lv1/lv2/%d/:a/:b", i), nop)
+	}
+	routers := []struct {
+		name string
+		h    http.Handler
+	}{
+		{"PathMux", pm},
+		{"ServeMux", sm},
+		{"HttpRouter", hr},
+	}
+
+	cases := []struct {
+		name string
+		uri  string
+	}{
+		{"Static", "http://localhost/lv1/static"},
+		{"Params", "http://localhost/lv1/lv2/500/var1/var2"},
+		{"404", "http://localhost/lv1/lv2/1001/var1/var2"},
+	}
+	for _, c := range cases {
+		for _, r := range routers {
+			b.Run(c.name+"/"+r.name, func(b *testing.B) {
+				benchDispatch(r.h, makeReq(c.uri), b)
+			})
+		}
+	}
+}
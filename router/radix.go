@@ -0,0 +1,255 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// matchState holds buffers used when matching, it is reused by statePool so
+// matching a request does not allocate
+type matchState struct {
+	path   string
+	sliced bool     // segs are substrings of path
+	segs   []string // segments of path
+	offs   []int    // offset of each segment in path, only if sliced
+	data   []string // captured variables
+}
+
+var statePool = sync.Pool{
+	New: func() interface{} { return new(matchState) },
+}
+
+func getState() *matchState {
+	return statePool.Get().(*matchState)
+}
+
+// release puts s back to pool, s must not be used after release
+func (s *matchState) release() {
+	s.path = ""
+	s.segs, s.offs, s.data = s.segs[:0], s.offs[:0], s.data[:0]
+	statePool.Put(s)
+}
+
+// split splits p into segments like splitPath, without allocating
+func (s *matchState) split(p string) {
+	p = strings.Trim(p, "/")
+	s.path, s.sliced = p, true
+	s.segs, s.offs, s.data = s.segs[:0], s.offs[:0], s.data[:0]
+
+	begin := 0
+	for {
+		idx := strings.IndexByte(p[begin:], '/')
+		if idx == -1 {
+			break
+		}
+		s.segs = append(s.segs, p[begin:begin+idx])
+		s.offs = append(s.offs, begin)
+		begin += idx + 1
+	}
+	s.segs = append(s.segs, p[begin:])
+	s.offs = append(s.offs, begin)
+}
+
+// setSegments uses segments split by caller, like unescaped ones
+func (s *matchState) setSegments(arr []string) {
+	s.path, s.sliced = "", false
+	s.segs = append(s.segs[:0], arr...)
+	s.offs, s.data = s.offs[:0], s.data[:0]
+}
+
+// restFrom returns segments from i-th one joined with "/"
+func (s *matchState) restFrom(i int) string {
+	if i >= len(s.segs) {
+		return ""
+	}
+	if s.sliced {
+		return s.path[s.offs[i]:]
+	}
+
+	return strings.Join(s.segs[i:], "/")
+}
+
+// radixEdge is a static child of radixNode, chains of static segments are
+// compressed into one edge
+type radixEdge struct {
+	label []string
+	node  *radixNode
+}
+
+type radixParam struct {
+	match func(string) bool
+	node  *radixNode
+}
+
+// radixNode is the read-only tree compiled from pathNode for matching, it has
+// exactly same semantics as pathNode
+type radixNode struct {
+	node     *pathNode // routes are read from here
+	edges    []radixEdge
+	index    map[string]int // first segment => index of edges, only if many edges
+	params   []radixParam
+	catchAll *radixNode
+	rest     *radixNode
+	prefix   *radixNode // compiled from child "", which matches anything remains
+}
+
+// maxEdges is max number of static edges to be searched linearly
+const maxEdges = 8
+
+// compact reports whether n can be merged into the edge to it
+func compact(n *pathNode) bool {
+	if len(n.routes) > 0 || len(n.params) > 0 || n.catchAll != nil || n.rest != nil || len(n.child) != 1 {
+		return false
+	}
+	_, ok := n.child[""]
+	return !ok
+}
+
+// compile converts the tree into radix tree
+func compile(n *pathNode) *radixNode {
+	ret := &radixNode{node: n}
+	for seg, c := range n.child {
+		if seg == "" {
+			ret.prefix = compile(c)
+			continue
+		}
+
+		label := []string{seg}
+		for compact(c) {
+			for s, next := range c.child {
+				label = append(label, s)
+				c = next
+			}
+		}
+		ret.edges = append(ret.edges, radixEdge{label: label, node: compile(c)})
+	}
+	if len(ret.edges) > maxEdges {
+		ret.index = make(map[string]int, len(ret.edges))
+		for x, e := range ret.edges {
+			ret.index[e.label[0]] = x
+		}
+	}
+
+	for _, p := range n.params {
+		ret.params = append(ret.params, radixParam{match: p.match, node: compile(p.node)})
+	}
+	if n.catchAll != nil {
+		ret.catchAll = compile(n.catchAll)
+	}
+	if n.rest != nil {
+		ret.rest = compile(n.rest)
+	}
+
+	return ret
+}
+
+// edge finds static edge beginning with seg
+func (n *radixNode) edge(seg string) *radixEdge {
+	if n.index != nil {
+		if x, ok := n.index[seg]; ok {
+			return &n.edges[x]
+		}
+		return nil
+	}
+
+	for x := range n.edges {
+		if n.edges[x].label[0] == seg {
+			return &n.edges[x]
+		}
+	}
+
+	return nil
+}
+
+// accepts reports whether the edge matches segments
+func (e *radixEdge) accepts(segs []string) bool {
+	if len(segs) < len(e.label) {
+		return false
+	}
+	for x := 1; x < len(e.label); x++ {
+		if e.label[x] != segs[x] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// match finds the node having route of method for segments of s from i-th
+// one, "" matches any method. Captured variables are appended to s.data.
+//
+// Static segments are tried first, then typed variables in registration
+// order, wildcard, {name...} and prefix.
+func (n *radixNode) match(s *matchState, i int, method string) *radixNode {
+	if i >= len(s.segs) {
+		if n.node.route(method) != nil {
+			return n
+		}
+		if n.rest != nil && n.rest.node.route(method) != nil {
+			s.data = append(s.data, "")
+			return n.rest
+		}
+		return nil
+	}
+
+	cur, l := s.segs[i], len(s.data)
+	if cur != "" {
+		if e := n.edge(cur); e != nil && e.accepts(s.segs[i:]) {
+			if leaf := e.node.match(s, i+len(e.label), method); leaf != nil {
+				return leaf
+			}
+		}
+		for x := range n.params {
+			p := &n.params[x]
+			if !p.match(cur) {
+				continue
+			}
+			s.data = append(s.data[:l], cur)
+			if leaf := p.node.match(s, i+1, method); leaf != nil {
+				return leaf
+			}
+		}
+		if n.catchAll != nil {
+			s.data = append(s.data[:l], cur)
+			if leaf := n.catchAll.match(s, i+1, method); leaf != nil {
+				return leaf
+			}
+		}
+	}
+
+	s.data = s.data[:l]
+	if n.rest != nil && n.rest.node.route(method) != nil {
+		s.data = append(s.data, s.restFrom(i))
+		return n.rest
+	}
+	if n.prefix != nil && n.prefix.node.route(method) != nil {
+		return n.prefix
+	}
+
+	return nil
+}
+
+// compiled returns radix tree of the table, it is compiled at first use
+func (t *routeTable) compiled() *radixNode {
+	t.once.Do(func() {
+		t.radix = compile(t.mappings)
+	})
+
+	return t.radix
+}
+
+// match finds route of the request, captured variables are copied
+func (t *routeTable) match(r *http.Request) (rt *route, data []string, found bool) {
+	s := getState()
+	defer s.release()
+
+	s.split(r.URL.Path)
+	data = []string{}
+	leaf := t.compiled().match(s, 0, r.Method)
+	if leaf == nil {
+		return nil, data, false
+	}
+
+	return leaf.node.route(r.Method), append(data, s.data...), true
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRadixCompress(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("/a/b/c/d", h)
+	m.HandleFunc("/a/b/x", h)
+	m.HandleFunc("/a/b/c/{id:int}", h)
+
+	root := m.table().compiled()
+	if len(root.edges) != 1 || !reflect.DeepEqual(root.edges[0].label, []string{"a", "b"}) {
+		t.Fatalf("expected /a/b to be compressed, got %#v", root.edges)
+	}
+
+	cases := map[string]bool{
+		"http://localhost/a/b/c/d": true,
+		"http://localhost/a/b/c/1": true,
+		"http://localhost/a/b/x":   true,
+		"http://localhost/a/b/c":   false,
+		"http://localhost/a/b":     false,
+		"http://localhost/a/c/x":   false,
+		"http://localhost/a//b/x":  false,
+	}
+	for uri, expect := range cases {
+		if _, _, found := m.table().match(makeReq(uri)); found != expect {
+			t.Errorf("%s: expected found to be %t, got %t", uri, expect, found)
+		}
+	}
+}
+
+func TestRadixIndex(t *testing.T) {
+	m := ByPath()
+	for x := 0; x < maxEdges*2; x++ {
+		m.HandleFunc(fmt.Sprintf("/%d/{id}", x), h)
+	}
+	m.HandleFunc("/{name:alpha}/{id}", h)
+
+	if m.table().compiled().index == nil {
+		t.Fatal("expected edges to be indexed")
+	}
+	cases := map[string][]string{
+		"http://localhost/0/a":  {"a"},
+		"http://localhost/15/b": {"b"},
+		"http://localhost/x/c":  {"x", "c"},
+	}
+	for uri, expect := range cases {
+		_, data, found := m.table().match(makeReq(uri))
+		if !found || !reflect.DeepEqual(data, expect) {
+			t.Errorf("%s: expected %v, got %v (found: %t)", uri, expect, data, found)
+		}
+	}
+	if _, _, found := m.table().match(makeReq("http://localhost/16/a")); found {
+		t.Error("expected /16/a not to match")
+	}
+}
+
+func TestRadixMatchNoAlloc(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("GET /user/{id:int}/post/{slug}", h)
+	m.HandleFunc("/user/{id:uuid}", h)
+	m.HandleFunc("/static/{path...}", h)
+	m.HandleFunc("/lv1/lv2/*/*", h)
+	root := m.table().compiled()
+
+	uris := []string{
+		"/user/42/post/hello",
+		"/user/123e4567-e89b-12d3-a456-426614174000",
+		"/static/css/site.css",
+		"/lv1/lv2/a/b",
+		"/not/found",
+	}
+	// not using statePool, as it might be cleared by GC when testing
+	s := new(matchState)
+	for _, uri := range uris {
+		allocs := testing.AllocsPerRun(100, func() {
+			s.split(uri)
+			root.match(s, 0, "GET")
+		})
+		if allocs != 0 {
+			t.Errorf("%s: expected no allocation, got %v", uri, allocs)
+		}
+	}
+}
+
+func TestVarsContext(t *testing.T) {
+	var data []string
+	var params Params
+	m := ByPath()
+	m.HandleFunc("/user/{id}/*/{rest...}", func(w http.ResponseWriter, r *http.Request) {
+		data, _ = GetPathVariable(r.Context())
+		params, _ = GetPathParams(r.Context())
+	})
+
+	serve(m, "GET", "http://localhost/user/1/x/a/b")
+	if !reflect.DeepEqual(data, []string{"1", "x", "a/b"}) {
+		t.Errorf("unexpected variables: %#v", data)
+	}
+	if !reflect.DeepEqual(params, Params{{"id", "1"}, {"rest", "a/b"}}) {
+		t.Errorf("unexpected params: %#v", params)
+	}
+}
+
+func TestConstraintTypes(t *testing.T) {
+	cases := map[string]map[string]bool{
+		"int":   {"0": true, "-12": true, "": false, "-": false, "1a": false, "+1": false},
+		"uint":  {"0": true, "12": true, "-1": false, "": false},
+		"hex":   {"0aF": true, "g": false, "": false},
+		"alpha": {"aZ": true, "a1": false, "": false},
+		"uuid": {
+			"123e4567-e89b-12d3-a456-426614174000":  true,
+			"123E4567-E89B-12D3-A456-426614174000":  true,
+			"123e4567-e89b-12d3-a456-42661417400":   false,
+			"123e4567xe89b-12d3-a456-426614174000":  false,
+			"123e4567-e89b-12d3-a456-42661417400g":  false,
+			"123e4567-e89b-12d3-a456-4266141740000": false,
+		},
+	}
+
+	for name, values := range cases {
+		f := compileConstraint(name)
+		for v, expect := range values {
+			if actual := f(v); actual != expect {
+				t.Errorf("%s(%q): expected %t, got %t", name, v, expect, actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// SlashPolicy defines how PathMux treats trailing slash in request path
+//
+// Trailing slash of request path is ignored when matching, so "/a" and "/a/"
+// always match the same route.
+type SlashPolicy int
+
+const (
+	// SlashIgnore does not redirect, this is default policy
+	SlashIgnore SlashPolicy = iota
+	// SlashRemove redirects "/a/" to "/a"
+	SlashRemove
+	// SlashAdd redirects "/a" to "/a/"
+	SlashAdd
+)
+
+// splitPath splits path into segments
+func splitPath(p string) []string {
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
+
+// splitEscaped splits escaped path into unescaped segments. If raw is false,
+// encoded slash is treated as separator.
+func splitEscaped(p string, raw bool) ([]string, bool) {
+	if !raw {
+		v, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, false
+		}
+		return splitPath(v), true
+	}
+
+	arr := splitPath(p)
+	for x, seg := range arr {
+		v, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, false
+		}
+		arr[x] = v
+	}
+
+	return arr, true
+}
+
+// split splits path of request into segments of s
+func (m *PathMux) split(s *matchState, r *http.Request) {
+	if m.UseRawPath && r.URL.RawPath != "" {
+		if arr, ok := splitEscaped(r.URL.EscapedPath(), true); ok {
+			s.setSegments(arr)
+			return
+		}
+	}
+
+	s.split(r.URL.Path)
+}
+
+// cleanPath is path.Clean but keeps trailing slash
+func cleanPath(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+
+	ret := path.Clean(p)
+	if strings.HasSuffix(p, "/") && ret != "/" {
+		if len(ret) == len(p)-1 && strings.HasPrefix(p, ret) {
+			// clean already, return it to avoid allocating
+			return p
+		}
+		ret += "/"
+	}
+
+	return ret
+}
+
+// canonical computes canonical path of request according to redirect
+// policies, it returns "" if path is canonical already or matches no route
+func (m *PathMux) canonical(t *routeTable, r *http.Request) string {
+	if !m.CleanPath && m.TrailingSlash == SlashIgnore && !m.CaseInsensitive {
+		return ""
+	}
+
+	orig := r.URL.EscapedPath()
+	p := orig
+	if m.CleanPath {
+		p = cleanPath(p)
+	}
+
+	s := getState()
+	if strings.IndexByte(p, '%') == -1 {
+		s.split(p)
+	} else if arr, ok := splitEscaped(p, m.UseRawPath); ok {
+		s.setSegments(arr)
+	} else {
+		s.release()
+		return ""
+	}
+	leaf := t.compiled().match(s, 0, "")
+	// mounted handlers decide trailing slash themselves, like FileServer
+	mounted := false
+	if leaf != nil {
+		rt := leaf.node.route(r.Method)
+		mounted = rt != nil && rt.mount
+	}
+	if leaf == nil {
+		if !m.CaseInsensitive {
+			s.release()
+			return ""
+		}
+		// fold may return arr itself, which is modified below
+		arr := append([]string(nil), s.segs...)
+		s.release()
+		fixed, ok := t.mappings.fold(arr)
+		if !ok {
+			return ""
+		}
+
+		for x, seg := range fixed {
+			fixed[x] = url.PathEscape(seg)
+		}
+		trailing := strings.HasSuffix(p, "/")
+		p = "/" + strings.Join(fixed, "/")
+		if trailing && p != "/" {
+			p += "/"
+		}
+	} else {
+		s.release()
+	}
+
+	switch {
+	case mounted:
+	case m.TrailingSlash == SlashRemove:
+		if p != "/" {
+			p = strings.TrimRight(p, "/")
+		}
+	case m.TrailingSlash == SlashAdd:
+		if !strings.HasSuffix(p, "/") {
+			p += "/"
+		}
+	}
+
+	// prevent redirecting to protocol-relative url like "//example.com"
+	if strings.HasPrefix(p, "//") {
+		p = "/" + strings.TrimLeft(p, "/")
+	}
+	if p == orig {
+		return ""
+	}
+
+	return p
+}
+
+// redirect redirects request to target path, keeping query string
+func (m *PathMux) redirect(w http.ResponseWriter, r *http.Request, target string) {
+	code := m.RedirectCode
+	if code == 0 {
+		code = http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+	}
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	w.Header().Set("Location", target)
+	w.WriteHeader(code)
+}
+
+// fold finds path case-insensitively, returns segments with static ones
+// replaced by registered form
+func (n *pathNode) fold(arr []string) (fixed []string, found bool) {
+	if len(arr) < 1 {
+		if n.route("") != nil || (n.rest != nil && n.rest.route("") != nil) {
+			return []string{}, true
+		}
+		return
+	}
+
+	cur := arr[0]
+	prepend := func(seg string, next *pathNode) bool {
+		f, ok := next.fold(arr[1:])
+		if ok {
+			fixed = append([]string{seg}, f...)
+		}
+		return ok
+	}
+
+	if cur != "" {
+		if next, ok := n.child[cur]; ok && prepend(cur, next) {
+			return fixed, true
+		}
+		for seg, next := range n.child {
+			if seg != "" && seg != cur && strings.EqualFold(seg, cur) && prepend(seg, next) {
+				return fixed, true
+			}
+		}
+		for _, p := range n.params {
+			if p.match(cur) && prepend(cur, p.node) {
+				return fixed, true
+			}
+		}
+		if n.catchAll != nil && prepend(cur, n.catchAll) {
+			return fixed, true
+		}
+	}
+
+	if n.rest != nil && n.rest.route("") != nil {
+		return arr, true
+	}
+	if next, ok := n.child[""]; ok && next.route("") != nil {
+		return arr, true
+	}
+
+	return
+}
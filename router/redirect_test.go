@@ -0,0 +1,79 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPathMuxRedirect(t *testing.T) {
+	cases := []struct {
+		name   string
+		setup  func(m *PathMux)
+		method string
+		uri    string
+		code   int
+		loc    string
+	}{
+		{"Default", func(m *PathMux) {}, "GET", "http://localhost/a/../User//1", 404, ""},
+		{"Clean", func(m *PathMux) { m.CleanPath = true }, "GET", "http://localhost/a/../user//1?x=1", 301, "/user/1?x=1"},
+		{"CleanKeepSlash", func(m *PathMux) { m.CleanPath = true }, "GET", "http://localhost/user/./1/", 301, "/user/1/"},
+		{"CleanPost", func(m *PathMux) { m.CleanPath = true }, "POST", "http://localhost/user//1", 308, "/user/1"},
+		{"CleanNotFound", func(m *PathMux) { m.CleanPath = true }, "GET", "http://localhost/post//1", 404, ""},
+		{"CleanCanonical", func(m *PathMux) { m.CleanPath = true }, "GET", "http://localhost/user/1", 200, ""},
+		{"RemoveSlash", func(m *PathMux) { m.TrailingSlash = SlashRemove }, "GET", "http://localhost/user/1/", 301, "/user/1"},
+		{"RemoveSlashRoot", func(m *PathMux) { m.TrailingSlash = SlashRemove }, "GET", "http://localhost/", 404, ""},
+		{"AddSlash", func(m *PathMux) { m.TrailingSlash = SlashAdd }, "GET", "http://localhost/user/1", 301, "/user/1/"},
+		{"AddSlashCanonical", func(m *PathMux) { m.TrailingSlash = SlashAdd }, "GET", "http://localhost/user/1/", 200, ""},
+		{"Case", func(m *PathMux) { m.CaseInsensitive = true }, "GET", "http://localhost/USER/AbC", 301, "/user/AbC"},
+		{"CaseStatic", func(m *PathMux) { m.CaseInsensitive = true }, "GET", "http://localhost/User/Me", 301, "/user/me"},
+		{"CaseExact", func(m *PathMux) { m.CaseInsensitive = true }, "GET", "http://localhost/user/Me", 200, ""},
+		{"CaseNotFound", func(m *PathMux) { m.CaseInsensitive = true }, "GET", "http://localhost/post/1", 404, ""},
+		{"NoProtocolRelative", func(m *PathMux) { m.TrailingSlash = SlashRemove }, "GET", "http://localhost//user/1/", 301, "/user/1"},
+		{"CustomCode", func(m *PathMux) {
+			m.CleanPath = true
+			m.RedirectCode = http.StatusFound
+		}, "GET", "http://localhost/user//1", 302, "/user/1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := ByPath()
+			m.HandleFunc("/user/{id}", h)
+			m.HandleFunc("/user/me", h)
+			c.setup(m)
+
+			w := serve(m, c.method, c.uri)
+			if w.Code != c.code {
+				t.Errorf("expected status %d, got %d", c.code, w.Code)
+			}
+			if loc := w.Header().Get("Location"); loc != c.loc {
+				t.Errorf("expected location '%s', got '%s'", c.loc, loc)
+			}
+		})
+	}
+}
+
+func TestPathMuxRawPath(t *testing.T) {
+	var name string
+	m := ByPath()
+	m.HandleFunc("/file/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name, _ = GetPathParam(r.Context(), "name")
+	})
+
+	if w := serve(m, "GET", "http://localhost/file/a%2Fb"); w.Code != 404 {
+		t.Errorf("expected encoded slash to be separator by default, got status %d", w.Code)
+	}
+
+	m.UseRawPath = true
+	if w := serve(m, "GET", "http://localhost/file/a%2Fb"); w.Code != 200 {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if name != "a/b" {
+		t.Errorf("expected name to be 'a/b', got '%s'", name)
+	}
+
+	m.CleanPath = true
+	if w := serve(m, "GET", "http://localhost/x/../file/a%2Fb"); w.Header().Get("Location") != "/file/a%2Fb" {
+		t.Errorf("expected to redirect to encoded path, got '%s'", w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,205 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RouteInfo describes a route registered to PathMux
+type RouteInfo struct {
+	Name    string // empty if route is not named
+	Method  string // empty if route accepts any method
+	Pattern string // path pattern, including prefix of Group
+}
+
+// urlSegment is a segment of pattern used to build URL
+type urlSegment struct {
+	static   string
+	variable bool
+	rest     bool
+	match    func(string) bool // nil if not constrained
+}
+
+// namedRoute holds informations to build URL of a route
+type namedRoute struct {
+	RouteInfo
+	wild string
+	segs []urlSegment // only compiled for named route
+}
+
+// compile splits pattern into segments
+func (rt *namedRoute) compile() {
+	arr := strings.Split(strings.TrimLeft(rt.Pattern, "/"), "/")
+	rt.segs = make([]urlSegment, 0, len(arr))
+	for _, seg := range arr {
+		if seg == rt.wild {
+			rt.segs = append(rt.segs, urlSegment{variable: true})
+			continue
+		}
+
+		_, constraint, rest, ok := parseParam(seg)
+		if !ok {
+			rt.segs = append(rt.segs, urlSegment{static: seg})
+			continue
+		}
+
+		s := urlSegment{variable: true, rest: rest}
+		if constraint != "" {
+			s.match = compileConstraint(constraint)
+		}
+		rt.segs = append(rt.segs, s)
+	}
+}
+
+// build fills variables in order and escapes them
+func (rt *namedRoute) build(args []string) (string, error) {
+	arr := make([]string, 0, len(rt.segs))
+	idx := 0
+	for _, s := range rt.segs {
+		if !s.variable {
+			arr = append(arr, s.static)
+			continue
+		}
+		if idx >= len(args) {
+			break
+		}
+
+		v := args[idx]
+		idx++
+		if s.match != nil && !s.match(v) {
+			return "", errors.New("router: argument " + strconv.Quote(v) + " does not match route " + rt.Name)
+		}
+		if !s.rest {
+			arr = append(arr, url.PathEscape(v))
+			continue
+		}
+
+		parts := strings.Split(v, "/")
+		for x, p := range parts {
+			parts[x] = url.PathEscape(p)
+		}
+		arr = append(arr, strings.Join(parts, "/"))
+	}
+
+	if idx != len(args) || len(arr) != len(rt.segs) {
+		return "", errors.New("router: route " + rt.Name + " has " + strconv.Itoa(rt.vars()) + " variables, got " + strconv.Itoa(len(args)))
+	}
+
+	return "/" + strings.Join(arr, "/"), nil
+}
+
+// vars counts variables in pattern
+func (rt *namedRoute) vars() (ret int) {
+	for _, s := range rt.segs {
+		if s.variable {
+			ret++
+		}
+	}
+
+	return
+}
+
+// record saves informations of registered route, replacing route with same
+// method and pattern
+func (t *routeTable) record(name, method, pattern, wild string) {
+	rt := &namedRoute{
+		RouteInfo: RouteInfo{Name: name, Method: method, Pattern: pattern},
+		wild:      wild,
+	}
+
+	if idx := t.find(method, pattern); idx != -1 {
+		old := t.routes[idx]
+		if name == "" {
+			rt.Name = old.Name
+		} else if old.Name != "" {
+			delete(t.names, old.Name)
+		}
+		t.routes[idx] = rt
+	} else {
+		t.index[routeKey{method, pattern}] = len(t.routes)
+		t.routes = append(t.routes, rt)
+	}
+
+	if rt.Name != "" {
+		rt.compile()
+		t.names[rt.Name] = rt
+	}
+}
+
+// unrecord removes informations of the route
+func (t *routeTable) unrecord(method, pattern string) {
+	idx := t.find(method, pattern)
+	if idx == -1 {
+		return
+	}
+
+	if name := t.routes[idx].Name; name != "" {
+		delete(t.names, name)
+	}
+	delete(t.index, routeKey{method, pattern})
+	t.routes = append(t.routes[:idx], t.routes[idx+1:]...)
+	for x := idx; x < len(t.routes); x++ {
+		t.index[routeKey{t.routes[x].Method, t.routes[x].Pattern}] = x
+	}
+}
+
+// HandleNamed registers a handler like Handle, and names the route so you
+// can build URL of it with PathMux.URL
+//
+// It panics if pattern is invalid or name is used.
+//
+// This method is thread-safe.
+func (m *PathMux) HandleNamed(name, pattern string, h http.Handler) {
+	if name == "" {
+		panic(errors.New("mux: route name cannot be empty"))
+	}
+
+	m.handle(name, pattern, h)
+}
+
+// HandleFuncNamed registers a handler function like HandleNamed
+func (m *PathMux) HandleFuncNamed(name, pattern string, h func(http.ResponseWriter, *http.Request)) {
+	m.HandleNamed(name, pattern, http.HandlerFunc(h))
+}
+
+// URL builds path of named route, variables (including wildcards) are filled
+// by args in order and escaped
+//
+//    m.HandleFuncNamed("user.show", "GET /user/{id:int}", showUser)
+//    u, err := m.URL("user.show", "42") // "/user/42"
+//
+// It returns an error if the route is not found, number of args mismatches,
+// or any arg does not match the constraint.
+func (m *PathMux) URL(name string, args ...string) (string, error) {
+	rt, ok := m.table().names[name]
+	if !ok {
+		return "", errors.New("router: route not found: " + name)
+	}
+
+	return rt.build(args)
+}
+
+// Routes lists registered routes in order of registration, for debugging
+func (m *PathMux) Routes() []RouteInfo {
+	routes := m.table().routes
+	ret := make([]RouteInfo, 0, len(routes))
+	for _, rt := range routes {
+		ret = append(ret, rt.RouteInfo)
+	}
+
+	return ret
+}
+
+// HandleNamed registers a named handler for prefix + pattern, see
+// PathMux.HandleNamed
+func (g *Group) HandleNamed(name, pattern string, h http.Handler) {
+	g.mux.HandleNamed(name, g.pattern(pattern), g.wrap(h))
+}
+
+// HandleFuncNamed registers a named handler function for prefix + pattern
+func (g *Group) HandleFuncNamed(name, pattern string, h func(http.ResponseWriter, *http.Request)) {
+	g.HandleNamed(name, pattern, http.HandlerFunc(h))
+}
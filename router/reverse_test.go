@@ -0,0 +1,101 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathMuxURL(t *testing.T) {
+	m := ByPath()
+	m.HandleFuncNamed("home", "GET /", h)
+	m.HandleFuncNamed("user.show", "GET /user/{id:int}", h)
+	m.HandleFuncNamed("user.post", "/user/{id}/posts/*/", h)
+	m.Group("/static").HandleFuncNamed("static", "GET /{path...}", h)
+
+	cases := []struct {
+		name   string
+		args   []string
+		expect string
+		ok     bool
+	}{
+		{"home", nil, "/", true},
+		{"home", []string{"1"}, "", false},
+		{"user.show", []string{"42"}, "/user/42", true},
+		{"user.show", []string{"me"}, "", false},
+		{"user.show", nil, "", false},
+		{"user.post", []string{"a b", "c/d"}, "/user/a%20b/posts/c%2Fd/", true},
+		{"user.post", []string{"a"}, "", false},
+		{"static", []string{"js/a b.js"}, "/static/js/a%20b.js", true},
+		{"none", nil, "", false},
+	}
+
+	for _, c := range cases {
+		actual, err := m.URL(c.name, c.args...)
+		if c.ok != (err == nil) {
+			t.Errorf("%s%v: unexpected error: %v", c.name, c.args, err)
+			continue
+		}
+		if actual != c.expect {
+			t.Errorf("%s%v: expected '%s', got '%s'", c.name, c.args, c.expect, actual)
+		}
+	}
+}
+
+func TestPathMuxURLMatches(t *testing.T) {
+	m := ByPath()
+	m.HandleFuncNamed("post", "GET /user/{id}/posts/{slug}", h)
+
+	u, err := m.URL("post", "1", "hello world")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rt, data, found := m.table().match(makeReq("http://localhost" + u))
+	if !found {
+		t.Fatalf("expected generated url %s to match, but not", u)
+	}
+	if params := rt.namedParams(data); !reflect.DeepEqual(params, Params{{"id", "1"}, {"slug", "hello world"}}) {
+		t.Errorf("unexpected params: %#v", params)
+	}
+}
+
+func TestPathMuxRouteName(t *testing.T) {
+	m := ByPath()
+	m.HandleFuncNamed("a", "GET /a", h)
+	m.HandleFuncNamed("a", "GET /a", h) // replacing handler is fine
+
+	for _, pattern := range []string{"GET /b", "POST /a"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected duplicated name with %s to panic", pattern)
+				}
+			}()
+			m.HandleFuncNamed("a", pattern, h)
+		}()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected empty name to panic")
+		}
+	}()
+	m.HandleFuncNamed("", "/c", h)
+}
+
+func TestPathMuxRoutes(t *testing.T) {
+	m := ByPath()
+	m.HandleFuncNamed("user.show", "GET /user/{id}", h)
+	m.HandleFunc("POST /user/{id}", h)
+	m.Group("/api").Mount("/v1", ByPath())
+	m.HandleFunc("GET /user/{id}", h)
+
+	expect := []RouteInfo{
+		{Name: "user.show", Method: "GET", Pattern: "/user/{id}"},
+		{Method: "POST", Pattern: "/user/{id}"},
+		{Pattern: "/api/v1/{...}"},
+	}
+	if actual := m.Routes(); !reflect.DeepEqual(actual, expect) {
+		t.Errorf("expected routes %#v, got %#v", expect, actual)
+	}
+}
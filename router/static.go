@@ -0,0 +1,359 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// encodings are precompressed variants in order of preference
+var encodings = []struct {
+	name string // content coding
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// acceptsEncoding reports whether Accept-Encoding header accepts enc
+func acceptsEncoding(header, enc string) bool {
+	for _, item := range strings.Split(header, ",") {
+		arr := strings.Split(item, ";")
+		if !strings.EqualFold(strings.TrimSpace(arr[0]), enc) {
+			continue
+		}
+
+		for _, p := range arr[1:] {
+			p = strings.TrimSpace(p)
+			if !strings.HasPrefix(p, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(p[2:], 64); err == nil && q <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// maxTags is max number of ETags cached by a FileServer
+const maxTags = 4096
+
+// etagEntry is cached ETag of a file, valid until size or modification time
+// of the file changes
+type etagEntry struct {
+	size  int64
+	mtime int64
+	tag   string
+}
+
+// FileServer is a http.Handler serving files in fs.FS, like embed.FS
+//
+// It sets ETag (hash of file content) and Last-Modified (if modification time
+// is known), and supports conditional and range requests. Paths are relative
+// to root of the FS, so it is normally mounted by PathMux.Mount:
+//
+//    //go:embed dist
+//    var dist embed.FS
+//
+//    sub, _ := fs.Sub(dist, "dist")
+//    m.Mount("/app", NewFileServer(sub))
+//
+// Only GET and HEAD requests are accepted. Settings must not be changed after
+// serving requests.
+type FileServer struct {
+	fsys fs.FS
+	lock sync.Mutex
+	tags map[string]etagEntry // cache of ETag, at most maxTags entries
+	// Index is the file served for directory, default to "index.html". Empty
+	// string disables it.
+	Index string
+	// Listing enables listing files of directory without index file
+	Listing bool
+	// Precompressed enables serving "file.br" or "file.gz" in place of "file"
+	// if client accepts, default to true. It applies only to files with
+	// known content type.
+	Precompressed bool
+	// Fallback is the file served if the path is not found, single-page app
+	// usually set it to "index.html" so the app can handle the path. Empty
+	// string disables it. It applies only to paths without file extension or
+	// requests accepting text/html, so missing assets like "/app.js" are
+	// still not found.
+	Fallback string
+	// ErrHandler is used if the path is not found and fallback is disabled
+	ErrHandler http.Handler
+}
+
+// NewFileServer creates a new FileServer with default settings.
+//
+// Error handler returns 404 NOT FOUND.
+func NewFileServer(fsys fs.FS) *FileServer {
+	return &FileServer{
+		fsys:          fsys,
+		Index:         "index.html",
+		Precompressed: true,
+		ErrHandler:    http.HandlerFunc(errHandler),
+	}
+}
+
+// Static mounts files in fsys at prefix, see FileServer
+//
+// It panics if prefix is invalid.
+//
+// This method is thread-safe.
+func (m *PathMux) Static(prefix string, fsys fs.FS) {
+	m.Mount(prefix, NewFileServer(fsys))
+}
+
+// SPA mounts a single-page app at prefix, paths not found are served with
+// "index.html" of fsys so the app can route them
+//
+//    m.HandleFunc("GET /app/api/user/{id}", showUser) // routes have higher priority
+//    m.SPA("/app", sub)                               // "/app/user/1" => index.html
+//                                                     // "/app/none.js" => 404
+//
+// It panics if prefix is invalid.
+//
+// This method is thread-safe.
+func (m *PathMux) SPA(prefix string, fsys fs.FS) {
+	s := NewFileServer(fsys)
+	s.Fallback = "index.html"
+	m.Mount(prefix, s)
+}
+
+// ServeHTTP serves the file of request path, or use FileServer.ErrHandler if
+// not found
+//
+// Like http.FileServer, directories are redirected to the path with trailing
+// slash, so relative links in index file work. It includes the mounted root,
+// "/app" is redirected to "/app/".
+func (s *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		methodNotAllowedHandler(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	if s.serve(w, r, name, true) {
+		return
+	}
+	if s.Fallback != "" && acceptsFallback(r, name) && s.serve(w, r, s.Fallback, false) {
+		return
+	}
+
+	s.ErrHandler.ServeHTTP(w, r)
+}
+
+// acceptsFallback reports whether fallback file can be served for the path,
+// which is a route of single-page app instead of a missing asset
+func acceptsFallback(r *http.Request, name string) bool {
+	if path.Ext(name) == "" {
+		return true
+	}
+
+	for _, item := range strings.Split(r.Header.Get("Accept"), ",") {
+		mtype := strings.TrimSpace(strings.Split(item, ";")[0])
+		if strings.EqualFold(mtype, "text/html") {
+			return true
+		}
+	}
+	return false
+}
+
+// serve serves the file or index of directory, it returns false if not found
+//
+// direct means name is the request path, so listing is allowed and
+// directories are redirected.
+func (s *FileServer) serve(w http.ResponseWriter, r *http.Request, name string, direct bool) bool {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() {
+		s.serveFile(w, r, name, f, info)
+		return true
+	}
+
+	index := ""
+	if s.Index != "" {
+		index = path.Join(name, s.Index)
+		if info, err := fs.Stat(s.fsys, index); err != nil || info.IsDir() {
+			index = ""
+		}
+	}
+	if index == "" && !(direct && s.Listing) {
+		return false
+	}
+
+	p := r.URL.Path
+	if name == "." {
+		// mounted root is "/" for both "/app" and "/app/"
+		p = requestPath(r)
+	}
+	if direct && !strings.HasSuffix(p, "/") {
+		// relative to request path, as mounted prefix is unknown here
+		u := url.URL{Path: "./" + path.Base(p) + "/", RawQuery: r.URL.RawQuery}
+		w.Header().Set("Location", u.String())
+		w.WriteHeader(http.StatusMovedPermanently)
+		return true
+	}
+	if index != "" {
+		return s.serve(w, r, index, false)
+	}
+
+	s.list(w, r, name)
+	return true
+}
+
+// serveFile serves the file, or precompressed variant of it
+func (s *FileServer) serveFile(w http.ResponseWriter, r *http.Request, name string, f fs.File, info fs.FileInfo) {
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if !s.Precompressed || ctype == "" {
+		s.serveContent(w, r, name, f, info)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	accept := r.Header.Get("Accept-Encoding")
+	for _, enc := range encodings {
+		if !acceptsEncoding(accept, enc.name) {
+			continue
+		}
+
+		cf, err := s.fsys.Open(name + enc.ext)
+		if err != nil {
+			continue
+		}
+		defer cf.Close()
+		cinfo, err := cf.Stat()
+		if err != nil || cinfo.IsDir() {
+			continue
+		}
+
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Encoding", enc.name)
+		s.serveContent(w, r, name+enc.ext, cf, cinfo)
+		return
+	}
+
+	s.serveContent(w, r, name, f, info)
+}
+
+// serveContent serves the file with ETag
+func (s *FileServer) serveContent(w http.ResponseWriter, r *http.Request, name string, f fs.File, info fs.FileInfo) {
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rs = bytes.NewReader(data)
+	}
+
+	tag, err := s.etag(name, rs, info)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", tag)
+	http.ServeContent(w, r, name, info.ModTime(), rs)
+}
+
+// etag computes ETag from content of the file, it is cached until size or
+// modification time of the file changes
+//
+// At most maxTags files are cached, an arbitrary one is dropped if full.
+func (s *FileServer) etag(name string, rs io.ReadSeeker, info fs.FileInfo) (string, error) {
+	size, mtime := info.Size(), info.ModTime().UnixNano()
+	s.lock.Lock()
+	e, ok := s.tags[name]
+	s.lock.Unlock()
+	if ok && e.size == size && e.mtime == mtime {
+		return e.tag, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rs); err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	tag := `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.tags == nil {
+		s.tags = map[string]etagEntry{}
+	}
+	if _, ok := s.tags[name]; !ok && len(s.tags) >= maxTags {
+		for k := range s.tags {
+			delete(s.tags, k)
+			break
+		}
+	}
+	s.tags[name] = etagEntry{size: size, mtime: mtime, tag: tag}
+	return tag, nil
+}
+
+// requestPath returns path of original request uri, which is not stripped
+// by PathMux.Mount or http.StripPrefix
+func requestPath(r *http.Request) string {
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		return u.Path
+	}
+	return r.URL.Path
+}
+
+// list writes links to files in the directory
+func (s *FileServer) list(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// links are relative to the directory, mounted prefix is unknown here so
+	// the original request uri is used
+	base := ""
+	if p := requestPath(r); !strings.HasSuffix(p, "/") {
+		base = path.Base(p) + "/"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintln(w, "<pre>")
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: base + n}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(n))
+	}
+	fmt.Fprintln(w, "</pre>")
+}
@@ -0,0 +1,248 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testModTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	file := func(data string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(data), ModTime: testModTime}
+	}
+	return fstest.MapFS{
+		"index.html":     file("index"),
+		"app.js":         file("plain js"),
+		"app.js.br":      file("br js"),
+		"app.js.gz":      file("gz js"),
+		"style.css":      file("plain css"),
+		"style.css.gz":   file("gz css"),
+		"docs/a.txt":     file("a"),
+		"docs/b c.txt":   file("b"),
+		"sub/index.html": file("sub index"),
+	}
+}
+
+func serveReq(m http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	return w
+}
+
+func TestFileServer(t *testing.T) {
+	m := ByPath()
+	m.Static("/static", testFS())
+
+	cases := []struct {
+		uri  string
+		code int
+		body string
+	}{
+		{"http://localhost/static/app.js", 200, "plain js"},
+		{"http://localhost/static/", 200, "index"},
+		{"http://localhost/static", 301, ""},
+		{"http://localhost/static/sub", 301, ""},
+		{"http://localhost/static/sub/", 200, "sub index"},
+		{"http://localhost/static/docs/b%20c.txt", 200, "b"},
+		{"http://localhost/static/docs/", 404, ""},
+		{"http://localhost/static/none.js", 404, ""},
+		{"http://localhost/static/../../app.js", 200, "plain js"},
+	}
+	for _, c := range cases {
+		w := serve(m, "GET", c.uri)
+		if w.Code != c.code {
+			t.Errorf("%s: expected status %d, got %d", c.uri, c.code, w.Code)
+			continue
+		}
+		if c.code == 200 && w.Body.String() != c.body {
+			t.Errorf("%s: expected body %q, got %q", c.uri, c.body, w.Body.String())
+		}
+	}
+
+	w := serve(m, "GET", "http://localhost/static/sub?a=1")
+	if loc := w.Header().Get("Location"); loc != "./sub/?a=1" {
+		t.Errorf("expected redirect to ./sub/?a=1, got %q", loc)
+	}
+
+	w = serve(m, "GET", "http://localhost/static?a=1")
+	if loc := w.Header().Get("Location"); loc != "./static/?a=1" {
+		t.Errorf("expected redirect to ./static/?a=1, got %q", loc)
+	}
+
+	w = serve(m, "POST", "http://localhost/static/app.js")
+	if w.Code != 405 || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("expected 405 with Allow header, got %d %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestFileServerTrailingSlash(t *testing.T) {
+	for _, policy := range []SlashPolicy{SlashRemove, SlashAdd} {
+		m := ByPath()
+		m.TrailingSlash = policy
+		m.Static("/static", testFS())
+
+		if w := serve(m, "GET", "http://localhost/static/sub/"); w.Code != 200 || w.Body.String() != "sub index" {
+			t.Errorf("policy %d: expected sub index, got %d %q", policy, w.Code, w.Body.String())
+		}
+		if w := serve(m, "GET", "http://localhost/static/app.js"); w.Code != 200 {
+			t.Errorf("policy %d: expected file to be served, got %d", policy, w.Code)
+		}
+	}
+}
+
+func TestFileServerCache(t *testing.T) {
+	s := NewFileServer(testFS())
+	w := serve(s, "GET", "http://localhost/app.js")
+	tag := w.Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("expected ETag to be set")
+	}
+	if lm := w.Header().Get("Last-Modified"); lm != testModTime.Format(http.TimeFormat) {
+		t.Errorf("unexpected Last-Modified: %s", lm)
+	}
+
+	req := makeReq("http://localhost/app.js")
+	req.Header = http.Header{"If-None-Match": {tag}}
+	if w := serveReq(s, req); w.Code != 304 {
+		t.Errorf("expected status 304 with ETag, got %d", w.Code)
+	}
+
+	req = makeReq("http://localhost/app.js")
+	req.Header = http.Header{"If-Modified-Since": {testModTime.Format(http.TimeFormat)}}
+	if w := serveReq(s, req); w.Code != 304 {
+		t.Errorf("expected status 304 with modification time, got %d", w.Code)
+	}
+
+	if other := serve(s, "GET", "http://localhost/style.css").Header().Get("ETag"); other == tag {
+		t.Error("expected different ETag for different content")
+	}
+}
+
+func TestFileServerCacheLimit(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < maxTags+10; i++ {
+		fsys[fmt.Sprintf("%d.txt", i)] = &fstest.MapFile{Data: []byte("data"), ModTime: testModTime}
+	}
+	s := NewFileServer(fsys)
+	for name := range fsys {
+		if w := serve(s, "GET", "http://localhost/"+name); w.Code != 200 {
+			t.Fatalf("%s: expected status 200, got %d", name, w.Code)
+		}
+	}
+	if l := len(s.tags); l != maxTags {
+		t.Errorf("expected %d ETags to be cached, got %d", maxTags, l)
+	}
+
+	s = NewFileServer(fsys)
+	tag := serve(s, "GET", "http://localhost/0.txt").Header().Get("ETag")
+	fsys["0.txt"] = &fstest.MapFile{Data: []byte("modified"), ModTime: testModTime.Add(time.Second)}
+	if other := serve(s, "GET", "http://localhost/0.txt").Header().Get("ETag"); other == tag {
+		t.Error("expected ETag to be changed with file")
+	}
+	if l := len(s.tags); l != 1 {
+		t.Errorf("expected modified file to replace cached ETag, got %d entries", l)
+	}
+}
+
+func TestFileServerPrecompressed(t *testing.T) {
+	s := NewFileServer(testFS())
+	cases := []struct {
+		uri    string
+		accept string
+		enc    string
+		body   string
+	}{
+		{"http://localhost/app.js", "gzip, br", "br", "br js"},
+		{"http://localhost/app.js", "gzip", "gzip", "gz js"},
+		{"http://localhost/app.js", "gzip, br;q=0", "gzip", "gz js"},
+		{"http://localhost/app.js", "", "", "plain js"},
+		{"http://localhost/style.css", "br, gzip", "gzip", "gz css"},
+		{"http://localhost/style.css", "br", "", "plain css"},
+	}
+
+	for _, c := range cases {
+		req := makeReq(c.uri)
+		req.Header = http.Header{"Accept-Encoding": {c.accept}}
+		w := serveReq(s, req)
+		if enc := w.Header().Get("Content-Encoding"); enc != c.enc {
+			t.Errorf("%s (%s): expected encoding %q, got %q", c.uri, c.accept, c.enc, enc)
+		}
+		if w.Body.String() != c.body {
+			t.Errorf("%s (%s): expected body %q, got %q", c.uri, c.accept, c.body, w.Body.String())
+		}
+		if ctype := w.Header().Get("Content-Type"); c.enc != "" && strings.Contains(ctype, "octet-stream") {
+			t.Errorf("%s (%s): expected content type of original file, got %s", c.uri, c.accept, ctype)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s (%s): expected Vary header", c.uri, c.accept)
+		}
+	}
+}
+
+func TestFileServerListing(t *testing.T) {
+	s := NewFileServer(testFS())
+	s.Listing = true
+
+	if w := serve(s, "GET", "http://localhost/docs"); w.Code != 301 {
+		t.Fatalf("expected directory to be redirected, got %d", w.Code)
+	}
+
+	w := serve(s, "GET", "http://localhost/docs/")
+	if w.Code != 200 {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, link := range []string{`href="a.txt"`, `href="b%20c.txt"`} {
+		if !strings.Contains(body, link) {
+			t.Errorf("expected %s in listing: %s", link, body)
+		}
+	}
+
+	if w := serve(s, "GET", "http://localhost/sub/"); w.Body.String() != "sub index" {
+		t.Errorf("expected index file instead of listing, got %q", w.Body.String())
+	}
+}
+
+func TestSPA(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("GET /app/api/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("api"))
+	})
+	m.SPA("/app", testFS())
+
+	cases := map[string]string{
+		"http://localhost/app/api/user":    "api",
+		"http://localhost/app/app.js":      "plain js",
+		"http://localhost/app/user/1":      "index",
+		"http://localhost/app/docs/":       "index",
+		"http://localhost/app/sub/missing": "index",
+	}
+	for uri, body := range cases {
+		w := serve(m, "GET", uri)
+		if w.Code != 200 || w.Body.String() != body {
+			t.Errorf("%s: expected %q, got %d %q", uri, body, w.Code, w.Body.String())
+		}
+	}
+
+	// missing assets are not found, unless browser navigates to them
+	for _, uri := range []string{"http://localhost/app/none.js", "http://localhost/app/favicon.ico"} {
+		if w := serve(m, "GET", uri); w.Code != 404 {
+			t.Errorf("%s: expected 404, got %d", uri, w.Code)
+		}
+	}
+	req := httptest.NewRequest("GET", "http://localhost/app/user/john.doe", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9")
+	if w := serveReq(m, req); w.Code != 200 || w.Body.String() != "index" {
+		t.Errorf("expected fallback for html request, got %d %q", w.Code, w.Body.String())
+	}
+
+	if w := serve(m, "GET", "http://localhost/other"); w.Code != 404 {
+		t.Errorf("expected paths outside prefix not to be served, got %d", w.Code)
+	}
+}
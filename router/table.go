@@ -0,0 +1,123 @@
+package router
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// routeTable holds registered routes. PathMux modifies its own table in
+// place, and serves snapshots of it, which are never modified.
+type routeTable struct {
+	mappings *pathNode
+	routes   []*namedRoute          // in order of registration
+	names    map[string]*namedRoute // name => route
+	index    map[routeKey]int       // index of t.routes, not set in snapshot
+
+	once  sync.Once
+	radix *radixNode // compiled from mappings, see compiled()
+}
+
+// routeKey identifies a route in routeTable
+type routeKey struct {
+	method  string
+	pattern string
+}
+
+// snapshot copies the table, so it can be served while t is being modified
+func (t *routeTable) snapshot() *routeTable {
+	ret := &routeTable{
+		mappings: t.mappings.copy(),
+		routes:   append([]*namedRoute(nil), t.routes...),
+		names:    make(map[string]*namedRoute, len(t.names)),
+	}
+	for k, v := range t.names {
+		ret.names[k] = v
+	}
+
+	return ret
+}
+
+// find returns index of the route in t.routes, or -1 if not found
+func (t *routeTable) find(method, pattern string) int {
+	if idx, ok := t.index[routeKey{method, pattern}]; ok {
+		return idx
+	}
+
+	return -1
+}
+
+// table returns current routes, taking a snapshot if routes are changed
+func (m *PathMux) table() *routeTable {
+	if m.dirty.Load() {
+		m.publish()
+	}
+
+	return m.tab.Load().(*routeTable)
+}
+
+// publish replaces routes being served with a snapshot of m.build
+func (m *PathMux) publish() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.dirty.Load() {
+		m.tab.Store(m.build.snapshot())
+		m.dirty.Store(false)
+	}
+}
+
+// update applies f to routes, which are published on next call to table(),
+// so registering many routes copies them only once. f must validate before
+// modifying anything, so routes are unchanged if it panics.
+func (m *PathMux) update(f func(t *routeTable)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	f(m.build)
+	m.dirty.Store(true)
+}
+
+// Remove unregisters the handler of pattern, which must be identical to the
+// one used to register, including method. It returns false if not found.
+//
+// Requests being served are not affected.
+//
+// This method is thread-safe.
+func (m *PathMux) Remove(pattern string) (removed bool) {
+	method, path := splitMethod(pattern)
+	if strings.HasPrefix(path, "/") {
+		path = cleanPattern(path)
+	}
+	m.update(func(t *routeTable) {
+		if t.find(method, path) == -1 {
+			return
+		}
+
+		removed = t.mappings.remove(m.Wildcard, method, path)
+		t.unrecord(method, path)
+	})
+
+	return
+}
+
+// Unmount unregisters the handler mounted at prefix, see Mount and Remove
+//
+// This method is thread-safe.
+func (m *PathMux) Unmount(prefix string) bool {
+	return m.Remove(mountPattern(prefix))
+}
+
+// Remove unregisters the handler of prefix + pattern, see PathMux.Remove
+func (g *Group) Remove(pattern string) bool {
+	return g.mux.Remove(g.pattern(pattern))
+}
+
+// Unmount unregisters the handler mounted at prefix, see PathMux.Unmount
+func (g *Group) Unmount(prefix string) bool {
+	if !strings.HasPrefix(prefix, "/") {
+		panic(errors.New("mux: prefix must begin with /"))
+	}
+
+	return g.mux.Unmount(g.prefix + prefix)
+}
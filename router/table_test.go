@@ -0,0 +1,212 @@
+package router
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestPathMuxRemove(t *testing.T) {
+	m := ByPath()
+	m.HandleFuncNamed("user.show", "GET /user/{id:int}", h)
+	m.HandleFunc("POST /user/{id:int}", h)
+	m.HandleFunc("/user/{name}/*", h)
+	m.HandleFunc("/file/{path...}", h)
+	m.Mount("/api", ByPath())
+	old := m.table()
+
+	if m.Remove("PUT /user/{id:int}") {
+		t.Error("expected removing unregistered method to fail")
+	}
+	if m.Remove("/user/{id:int}") {
+		t.Error("expected removing unregistered pattern to fail")
+	}
+
+	cases := []struct {
+		pattern string
+		method  string
+		uri     string
+		code    int
+	}{
+		{"GET /user/{id:int}", "GET", "http://localhost/user/1", 405},
+		{"POST /user/{id:int}", "POST", "http://localhost/user/1", 404},
+		{"/user/{name}/*", "GET", "http://localhost/user/a/b", 404},
+		{"/file/{path...}", "GET", "http://localhost/file/a/b", 404},
+	}
+	for _, c := range cases {
+		if !m.Remove(c.pattern) {
+			t.Errorf("expected %s to be removed", c.pattern)
+		}
+		if w := serve(m, c.method, c.uri); w.Code != c.code {
+			t.Errorf("%s: expected status %d, got %d", c.pattern, c.code, w.Code)
+		}
+	}
+
+	if !m.Unmount("/api/") {
+		t.Error("expected /api to be unmounted")
+	}
+	if w := serve(m, "GET", "http://localhost/api/a"); w.Code != 404 {
+		t.Errorf("expected mounted handler to be removed, got status %d", w.Code)
+	}
+
+	if routes := m.Routes(); len(routes) != 0 {
+		t.Errorf("expected no route, got %#v", routes)
+	}
+	if _, err := m.URL("user.show", "1"); err == nil {
+		t.Error("expected route name to be removed")
+	}
+	if !m.table().mappings.empty() {
+		t.Errorf("expected empty nodes to be pruned, got %#v", m.table().mappings)
+	}
+
+	// snapshot taken before removing is not affected
+	if _, _, found := old.match(makeReq("http://localhost/user/1")); !found {
+		t.Error("expected old snapshot to be unchanged")
+	}
+}
+
+func TestPathMuxRemoveKeepsOthers(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("/a/g", h)
+	m.HandleFunc("/a/g/c", h)
+	m.HandleFunc("/a/{x:int}", h)
+	m.HandleFunc("/a/{y:hex}", h)
+
+	m.Remove("/a/g")
+	m.Remove("/a/{x:int}")
+
+	cases := map[string]bool{
+		"http://localhost/a/g":   false,
+		"http://localhost/a/g/c": true,
+		"http://localhost/a/1z":  false,
+		"http://localhost/a/ff":  true,
+	}
+	for uri, expect := range cases {
+		if _, _, found := m.table().match(makeReq(uri)); found != expect {
+			t.Errorf("%s: expected found to be %t, got %t", uri, expect, found)
+		}
+	}
+
+	expect := []RouteInfo{{Pattern: "/a/g/c"}, {Pattern: "/a/{y:hex}"}}
+	if routes := m.Routes(); !reflect.DeepEqual(routes, expect) {
+		t.Errorf("expected routes %#v, got %#v", expect, routes)
+	}
+}
+
+func TestPathMuxConcurrentUpdate(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("/static", h)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				pattern := fmt.Sprintf("/dyn/%d/%d/{id}", i, j)
+				m.HandleFunc(pattern, h)
+				if j%2 == 0 {
+					m.Remove(pattern)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if w := serve(m, "GET", "http://localhost/static"); w.Code != 200 {
+					t.Errorf("expected static route to be available, got %d", w.Code)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if l := len(m.Routes()); l != 201 {
+		t.Errorf("expected 201 routes, got %d", l)
+	}
+}
+
+func TestPathMuxFailedUpdate(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("/a/{x}", h)
+
+	func() {
+		defer func() { recover() }()
+		m.HandleFunc("/a/{x}/b/{x}", h)
+	}()
+	func() {
+		defer func() { recover() }()
+		m.HandleFunc("/c/{x}/{y:[a-}", h)
+	}()
+
+	if _, _, found := m.table().match(makeReq("http://localhost/a/1/b/2")); found {
+		t.Error("expected routes to be unchanged when registering failed")
+	}
+	if l := len(m.Routes()); l != 1 {
+		t.Errorf("expected 1 route, got %d", l)
+	}
+	if _, ok := m.build.mappings.child["c"]; ok {
+		t.Error("expected no node to be created when registering failed")
+	}
+}
+
+func TestPathMuxSnapshot(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("/a", h)
+	m.HandleFunc("/b", h)
+	m.HandleFunc("/c", h)
+
+	old := m.table()
+	if m.table() != old {
+		t.Error("expected snapshot to be reused if routes are unchanged")
+	}
+
+	m.Remove("/a")
+	m.HandleFunc("/a", h)
+	m.HandleFunc("/c", h)
+	if m.table() == old {
+		t.Error("expected new snapshot after routes are changed")
+	}
+	if _, _, found := old.match(makeReq("http://localhost/a")); !found {
+		t.Error("expected old snapshot to be unchanged")
+	}
+
+	expect := []RouteInfo{{Pattern: "/b"}, {Pattern: "/c"}, {Pattern: "/a"}}
+	if routes := m.Routes(); !reflect.DeepEqual(routes, expect) {
+		t.Errorf("expected routes %#v, got %#v", expect, routes)
+	}
+}
+
+func TestPathMuxConflict(t *testing.T) {
+	m := ByPath()
+	m.HandleFunc("/a/{id}", h)
+	m.HandleFunc("POST /a/*", h)
+	m.HandleFunc("//a/{id}", h) // same pattern replaces
+
+	for _, pattern := range []string{"/a/*", "/a/{name}", "POST /a/{id}"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected %s to conflict", pattern)
+				}
+			}()
+			m.HandleFunc(pattern, h)
+		}()
+	}
+
+	expect := []RouteInfo{{Pattern: "/a/{id}"}, {Method: "POST", Pattern: "/a/*"}}
+	if routes := m.Routes(); !reflect.DeepEqual(routes, expect) {
+		t.Errorf("expected routes %#v, got %#v", expect, routes)
+	}
+
+	m.Remove("/a/{id}")
+	expect = expect[1:]
+	if routes := m.Routes(); !reflect.DeepEqual(routes, expect) {
+		t.Errorf("expected routes %#v, got %#v", expect, routes)
+	}
+	if w := serve(m, "GET", "http://localhost/a/1"); w.Code != 405 {
+		t.Errorf("expected GET to be removed, got status %d", w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/Ronmi/rtoolkit/session/store"
+)
+
+// ErrConflict is returned by Session.SetData if the session has been modified
+// by another request, see ConflictPolicy
+var ErrConflict = store.ErrConflict
+
+// ConflictPolicy decides what to do if concurrent requests of same session
+// modify session data
+type ConflictPolicy int
+
+const (
+	// ConflictOverwrite is the default policy: last writer wins
+	ConflictOverwrite ConflictPolicy = iota
+	// ConflictFail makes Session.SetData return ErrConflict if the session
+	// has been modified since loaded. Requires store.VersionedStore.
+	ConflictFail
+	// ConflictMerge calls Manager.Merge to merge data if the session has
+	// been modified since loaded, and tries again. Requires
+	// store.VersionedStore.
+	ConflictMerge
+	// ConflictLock serializes requests of same session with a per-session
+	// lock, from Manager.Start to Session.Close. The lock works only within
+	// current process, so it is suitable only for single-process deployment
+	// like using store.InMemory.
+	ConflictLock
+)
+
+// how many times to merge before giving up
+const mergeRetry = 3
+
+// MergeFunc resolves conflict for ConflictMerge policy
+//
+// base is session data when loaded (or last merged), stored is current data
+// in store, and local is the data you're trying to save. It returns data to
+// be saved.
+type MergeFunc func(base, stored, local string) (string, error)
+
+// Close releases the per-session lock acquired by Manager.Start if policy is
+// ConflictLock, it is a no-op otherwise.
+//
+// With ConflictLock, you SHOULD call Close() when you're done with the
+// session. The lock is released when context of the request is done too, but
+// other requests of this session are blocked until that. Middlewares in this
+// package (and apitool.Session) do it for you.
+func (s *Session) Close() {
+	if s.unlock == nil {
+		return
+	}
+
+	unlock := s.unlock
+	s.unlock = nil
+	unlock()
+}
+
+// holding reports whether the lock of session id is held by a session started
+// by r, or the request which r is derived from by NewMiddleware
+func (m *Manager) holding(id string, r *http.Request) bool {
+	m.hlock.Lock()
+	h, ok := m.holders[id]
+	m.hlock.Unlock()
+	if !ok {
+		return false
+	}
+
+	sess, _ := FromMiddleware(r.Context())
+	return h.r == r || h == sess
+}
+
+// hold records s as holder of its lock, the lock is released by s.Close() or
+// when context of s is done
+func (m *Manager) hold(s *Session) {
+	m.hlock.Lock()
+	m.holders[s.id] = s
+	m.hlock.Unlock()
+
+	once := &sync.Once{}
+	release := func() {
+		once.Do(func() {
+			m.hlock.Lock()
+			if m.holders[s.id] == s {
+				delete(m.holders, s.id)
+			}
+			m.hlock.Unlock()
+			m.locks.Unlock(s.id)
+		})
+	}
+	stop := context.AfterFunc(s.ctx, release)
+	s.unlock = func() {
+		stop()
+		release()
+	}
+}
+
+// write saves data according to conflict policy, returns saved data
+func (s *Session) write(data string) (string, error) {
+	cs := s.m.store()
+	if s.m.Conflict == ConflictOverwrite || s.m.Conflict == ConflictLock {
+		return data, cs.SetContext(s.ctx, s.id, s.seed, data)
+	}
+
+	base := s.data
+	for x := 0; ; x++ {
+		err := cs.SetVersionContext(s.ctx, s.id, s.seed, data, s.info.Version)
+		if err == nil {
+			s.info.Version++
+			return data, nil
+		}
+
+		if err != store.ErrConflict || s.m.Conflict != ConflictMerge || s.m.Merge == nil || x >= mergeRetry {
+			return "", err
+		}
+
+		seed, stored, info, err := cs.GetContext(s.ctx, s.id)
+		if err != nil {
+			return "", err
+		}
+		if seed != s.seed {
+			return "", errors.New("rtoolkit/session: seed mismatch for " + s.id)
+		}
+
+		if data, err = s.m.Merge(base, stored, data); err != nil {
+			return "", err
+		}
+		base = stored
+		s.info = info
+	}
+}
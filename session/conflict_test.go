@@ -0,0 +1,220 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startPair starts a session, and loads it twice like two concurrent requests
+func startPair(t *testing.T, m *Manager) (*Session, *Session) {
+	w := httptest.NewRecorder()
+	if _, err := m.Start(w, httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+
+	s1, err := m.Start(httptest.NewRecorder(), forward(w))
+	if err != nil {
+		t.Fatalf("cannot load session: %s", err)
+	}
+	s2, err := m.Start(httptest.NewRecorder(), forward(w))
+	if err != nil {
+		t.Fatalf("cannot load session: %s", err)
+	}
+
+	return s1, s2
+}
+
+func TestConflictFail(t *testing.T) {
+	m := &Manager{Conflict: ConflictFail}
+	s1, s2 := startPair(t, m)
+
+	if err := s1.SetData("a"); err != nil {
+		t.Fatalf("cannot set data: %s", err)
+	}
+	if err := s2.SetData("b"); err != ErrConflict {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	// read-only request should not overwrite data
+	if err := s2.Save(httptest.NewRecorder()); err != nil {
+		t.Fatalf("cannot save: %s", err)
+	}
+
+	_, data, _ := m.Store.Get(s1.ID())
+	if data != "a" {
+		t.Errorf("expected data to be a, got %s", data)
+	}
+}
+
+func TestConflictMerge(t *testing.T) {
+	m := &Manager{
+		Conflict: ConflictMerge,
+		Merge: func(base, stored, local string) (string, error) {
+			return stored + local[len(base):], nil
+		},
+	}
+	s1, s2 := startPair(t, m)
+
+	if err := s1.SetData("a"); err != nil {
+		t.Fatalf("cannot set data: %s", err)
+	}
+	if err := s2.SetData("b"); err != nil {
+		t.Fatalf("cannot set data: %s", err)
+	}
+	if s2.Data() != "ab" {
+		t.Errorf("expected merged data to be ab, got %s", s2.Data())
+	}
+
+	_, data, _ := m.Store.Get(s1.ID())
+	if data != "ab" {
+		t.Errorf("expected data to be ab, got %s", data)
+	}
+}
+
+func TestConflictLock(t *testing.T) {
+	m := &Manager{Conflict: ConflictLock}
+	w := httptest.NewRecorder()
+	sess, err := m.Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+	sess.Close()
+
+	wg := &sync.WaitGroup{}
+	run := func(r *http.Request, data string) {
+		defer wg.Done()
+		s, err := m.Start(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Errorf("cannot load session: %s", err)
+			return
+		}
+		defer s.Close()
+
+		if err = s.SetData(s.Data() + data); err != nil {
+			t.Errorf("cannot set data: %s", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if err = s.Save(httptest.NewRecorder()); err != nil {
+			t.Errorf("cannot save: %s", err)
+		}
+	}
+
+	wg.Add(2)
+	go run(forward(w), "a")
+	go run(forward(w), "b")
+	wg.Wait()
+
+	_, data, _ := m.Store.Get(sess.ID())
+	if data != "ab" && data != "ba" {
+		t.Errorf("expected both requests to be saved, got %s", data)
+	}
+}
+
+func TestConflictLockContext(t *testing.T) {
+	m := &Manager{Conflict: ConflictLock}
+	w := httptest.NewRecorder()
+	first, err := m.Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+	first.Close()
+
+	r := forward(w)
+	sess, err := m.Start(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatalf("cannot load session: %s", err)
+	}
+
+	// same request does not wait for the lock
+	again, err := m.Start(httptest.NewRecorder(), r)
+	if err != nil || again.ID() != sess.ID() {
+		t.Fatalf("expected same session when starting again, got %v", err)
+	}
+	again.Close()
+	mr := r.WithContext(context.WithValue(r.Context(), SessionObjectKey, sess))
+	if again, err = m.Start(httptest.NewRecorder(), mr); err != nil || again.ID() != sess.ID() {
+		t.Fatalf("expected same session in handler, got %v", err)
+	}
+
+	// other requests wait until their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = m.Start(httptest.NewRecorder(), forward(w).WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	sess.Close()
+	other, err := m.Start(httptest.NewRecorder(), forward(w))
+	if err != nil || other.ID() != sess.ID() {
+		t.Fatalf("expected lock to be released by Close, got %v", err)
+	}
+	other.Close()
+}
+
+func TestConflictLockReleasedWithRequest(t *testing.T) {
+	m := &Manager{Conflict: ConflictLock}
+	w := httptest.NewRecorder()
+	first, err := m.Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+	first.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err = m.Start(httptest.NewRecorder(), forward(w).WithContext(ctx)); err != nil {
+		t.Fatalf("cannot load session: %s", err)
+	}
+	cancel() // request ends without calling Close
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	sess, err := m.Start(httptest.NewRecorder(), forward(w).WithContext(ctx))
+	if err != nil || sess.ID() != first.ID() {
+		t.Fatalf("expected lock to be released with request, got %v", err)
+	}
+	sess.Close()
+}
+
+func TestConflictLockConcurrentInit(t *testing.T) {
+	w := httptest.NewRecorder()
+	first, err := (&Manager{}).Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+
+	// first requests to a new manager share the lock
+	m := &Manager{Store: first.m.Store, Conflict: ConflictLock}
+	var holding, max int32
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(r *http.Request) {
+			defer wg.Done()
+			s, err := m.Start(httptest.NewRecorder(), r)
+			if err != nil {
+				t.Errorf("cannot load session: %s", err)
+				return
+			}
+			defer s.Close()
+
+			cur := atomic.AddInt32(&holding, 1)
+			defer atomic.AddInt32(&holding, -1)
+			for {
+				old := atomic.LoadInt32(&max)
+				if cur <= old || atomic.CompareAndSwapInt32(&max, old, cur) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}(forward(w))
+	}
+	wg.Wait()
+
+	if max != 1 {
+		t.Errorf("expected lock to be held by one request at a time, got %d", max)
+	}
+}
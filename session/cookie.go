@@ -0,0 +1,103 @@
+package session
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SecurePolicy decides when to set Secure attribute of session cookies
+type SecurePolicy int
+
+const (
+	// SecureAuto sets Secure attribute if the request is sent over https,
+	// either directly (TLS) or via a reverse proxy (X-Forwarded-Proto).
+	SecureAuto SecurePolicy = iota
+	// SecureAlways always sets Secure attribute
+	SecureAlways
+	// SecureNever never sets Secure attribute
+	SecureNever
+)
+
+// Cookie name prefixes, see https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Set-Cookie#cookie_prefixes
+const (
+	// PrefixHost forces Secure attribute, Path to be "/" and no Domain
+	PrefixHost = "__Host-"
+	// PrefixSecure forces Secure attribute
+	PrefixSecure = "__Secure-"
+)
+
+// CookieOptions controls attributes of session cookies
+//
+// Options are applied on cookies created by Manager.MakeCookie, zero values
+// leave corresponding attributes unchanged.
+type CookieOptions struct {
+	Path        string
+	Domain      string
+	SameSite    http.SameSite
+	Secure      SecurePolicy // default to SecureAuto
+	Prefix      string       // PrefixHost, PrefixSecure or empty string
+	Partitioned bool         // also forces Secure attribute
+}
+
+// name returns cookie name with prefix
+func (o CookieOptions) name(name string) string {
+	return o.Prefix + name
+}
+
+func (o CookieOptions) apply(c *http.Cookie, secure bool) {
+	if o.Path != "" {
+		c.Path = o.Path
+	}
+	if o.Domain != "" {
+		c.Domain = o.Domain
+	}
+	if o.SameSite != 0 {
+		c.SameSite = o.SameSite
+	}
+
+	switch o.Secure {
+	case SecureAuto:
+		c.Secure = c.Secure || secure
+	case SecureAlways:
+		c.Secure = true
+	case SecureNever:
+		c.Secure = false
+	}
+
+	if o.Partitioned {
+		c.Partitioned = true
+		c.Secure = true
+	}
+
+	switch o.Prefix {
+	case PrefixHost:
+		c.Path = "/"
+		c.Domain = ""
+		c.Secure = true
+	case PrefixSecure:
+		c.Secure = true
+	}
+
+	// browsers reject SameSite=None without Secure
+	if c.SameSite == http.SameSiteNoneMode {
+		c.Secure = true
+	}
+}
+
+// IsSecure reports whether the request is sent over https, either directly
+// or via a reverse proxy which sets X-Forwarded-Proto header.
+func IsSecure(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	if r.TLS != nil {
+		return true
+	}
+
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if i := strings.IndexByte(proto, ','); i >= 0 {
+		// added by multiple proxies, the first one is what client uses
+		proto = proto[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
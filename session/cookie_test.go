@@ -0,0 +1,155 @@
+package session
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookieOptions(t *testing.T) {
+	cases := []struct {
+		name   string
+		opt    CookieOptions
+		https  bool
+		check  func(*http.Cookie) bool
+		expect string
+	}{
+		{
+			name:   "default",
+			check:  func(c *http.Cookie) bool { return c.Path == "/" && c.HttpOnly && !c.Secure },
+			expect: "path / httponly",
+		},
+		{
+			name:   "auto secure",
+			https:  true,
+			check:  func(c *http.Cookie) bool { return c.Secure },
+			expect: "secure",
+		},
+		{
+			name:   "never secure",
+			opt:    CookieOptions{Secure: SecureNever},
+			https:  true,
+			check:  func(c *http.Cookie) bool { return !c.Secure },
+			expect: "not secure",
+		},
+		{
+			name:   "always secure",
+			opt:    CookieOptions{Secure: SecureAlways},
+			check:  func(c *http.Cookie) bool { return c.Secure },
+			expect: "secure",
+		},
+		{
+			name:   "same site and domain",
+			opt:    CookieOptions{SameSite: http.SameSiteStrictMode, Domain: "example.com"},
+			check:  func(c *http.Cookie) bool { return c.SameSite == http.SameSiteStrictMode && c.Domain == "example.com" },
+			expect: "strict same site and domain",
+		},
+		{
+			name:   "same site none",
+			opt:    CookieOptions{SameSite: http.SameSiteNoneMode, Secure: SecureNever},
+			check:  func(c *http.Cookie) bool { return c.Secure },
+			expect: "secure",
+		},
+		{
+			name: "host prefix",
+			opt:  CookieOptions{Prefix: PrefixHost, Path: "/a", Domain: "example.com"},
+			check: func(c *http.Cookie) bool {
+				return c.Secure && c.Path == "/" && c.Domain == "" && c.Name == "__Host-SESSION_ID"
+			},
+			expect: "secure, path /, no domain and prefixed name",
+		},
+		{
+			name: "secure prefix",
+			opt:  CookieOptions{Prefix: PrefixSecure, Domain: "example.com"},
+			check: func(c *http.Cookie) bool {
+				return c.Secure && c.Domain == "example.com" && c.Name == "__Secure-SESSION_ID"
+			},
+			expect: "secure, domain and prefixed name",
+		},
+		{
+			name:   "partitioned",
+			opt:    CookieOptions{Partitioned: true},
+			check:  func(c *http.Cookie) bool { return c.Secure && c.Partitioned },
+			expect: "secure and partitioned",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := &Manager{Cookie: c.opt}
+			r := httptest.NewRequest("GET", "/", nil)
+			if c.https {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			if _, err := m.Start(w, r); err != nil {
+				t.Fatalf("cannot start session: %s", err)
+			}
+
+			found := false
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name != c.opt.Prefix+m.Key {
+					continue
+				}
+				found = true
+				if !c.check(cookie) {
+					t.Errorf("expected cookie to be %s, got %s", c.expect, cookie)
+				}
+			}
+			if !found {
+				t.Error("session cookie not found")
+			}
+		})
+	}
+}
+
+func TestIsSecure(t *testing.T) {
+	cases := []struct {
+		header string
+		expect bool
+	}{
+		{"", false},
+		{"http", false},
+		{"https", true},
+		{"HTTPS", true},
+		{"https, http", true},
+		{"http, https", false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Forwarded-Proto", c.header)
+		if actual := IsSecure(r); actual != c.expect {
+			t.Errorf("expected IsSecure to be %t with X-Forwarded-Proto `%s`, got %t", c.expect, c.header, actual)
+		}
+	}
+}
+
+func TestDestroyClearsCookies(t *testing.T) {
+	m := &Manager{Cookie: CookieOptions{Prefix: PrefixHost}}
+	w := httptest.NewRecorder()
+	if _, err := m.Start(w, httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+	sess, err := m.Start(httptest.NewRecorder(), forward(w))
+	if err != nil {
+		t.Fatalf("cannot resume session: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	sess.Destroy(w)
+
+	cleared := map[string]bool{}
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge < 0 && c.Value == "" {
+			cleared[c.Name] = true
+		}
+	}
+
+	for _, name := range []string{"__Host-SESSION_ID", "__Host-SESSION_CHECK"} {
+		if !cleared[name] {
+			t.Errorf("expected cookie %s to be cleared", name)
+		}
+	}
+}
@@ -14,10 +14,16 @@ const SessionObjectKey = ContextKey("session")
 
 // NewMiddleware creates a net/http based middleware.
 //
-// It allocates session instance before executing handler.
+// It allocates session instance before executing handler, and closes it
+// after handler returns.
 func NewMiddleware(m *Manager, h http.Handler) *middleware.Middleware {
 	return &middleware.Middleware{
-		Next: h,
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r)
+			if sess, ok := FromMiddleware(r.Context()); ok {
+				sess.Close()
+			}
+		}),
 		Handler: func(w http.ResponseWriter, r *http.Request) (error, *http.Request) {
 			req := r
 			sess, err := m.Start(w, r)
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+
+	"github.com/Ronmi/rtoolkit/session/store"
+)
+
+// Bind associates this session with owner (typically user id), so it can be
+// listed or revoked with Manager.List, Manager.Revoke and Manager.RevokeAll.
+//
+// Client IP (from http.Request.RemoteAddr) and user agent are recorded. If
+// your server is behind a reverse proxy, you should use a middleware to
+// rewrite RemoteAddr.
+//
+// It returns ErrNotSupported if the store does not implement
+// store.IndexedStore.
+func (s *Session) Bind(owner string) error {
+	var ip, ua string
+	if r := s.r; r != nil {
+		ip = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		ua = r.UserAgent()
+	}
+
+	return s.m.store().BindContext(s.ctx, s.id, owner, ip, ua)
+}
+
+// List returns active sessions of the owner, most recently used first.
+//
+// It returns ErrNotSupported if the store does not implement
+// store.IndexedStore.
+func (m *Manager) List(owner string) ([]store.Meta, error) {
+	m.init()
+	ret, err := m.store().ListContext(context.Background(), owner)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].LastSeen.After(ret[j].LastSeen)
+	})
+	return ret, nil
+}
+
+// Revoke clears a session of the owner, returns error if the session does not
+// belong to the owner.
+//
+// It returns ErrNotSupported if the store does not implement
+// store.IndexedStore.
+func (m *Manager) Revoke(owner, sessID string) error {
+	list, err := m.List(owner)
+	if err != nil {
+		return err
+	}
+
+	for _, meta := range list {
+		if meta.ID == sessID {
+			return m.store().ReleaseContext(context.Background(), sessID)
+		}
+	}
+
+	return errors.New("rtoolkit/session: session " + sessID + " does not belong to " + owner)
+}
+
+// RevokeAll clears all sessions of the owner, logs the user out everywhere.
+//
+// It returns ErrNotSupported if the store does not implement
+// store.IndexedStore.
+func (m *Manager) RevokeAll(owner string) error {
+	m.init()
+	return m.store().ReleaseAllContext(context.Background(), owner)
+}
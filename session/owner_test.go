@@ -0,0 +1,58 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManagerRevoke(t *testing.T) {
+	m := &Manager{}
+	start := func(ua string) *Session {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", ua)
+		sess, err := m.Start(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("cannot start session: %s", err)
+		}
+		if err = sess.Bind("user"); err != nil {
+			t.Fatalf("cannot bind session: %s", err)
+		}
+		return sess
+	}
+
+	s1 := start("agent 1")
+	s2 := start("agent 2")
+
+	list, err := m.List("user")
+	if err != nil {
+		t.Fatalf("cannot list sessions: %s", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(list))
+	}
+	for _, meta := range list {
+		if meta.IP != "192.0.2.1" {
+			t.Errorf("expected ip to be recorded, got %s", meta.IP)
+		}
+		if meta.UserAgent != "agent 1" && meta.UserAgent != "agent 2" {
+			t.Errorf("unexpected user agent %s", meta.UserAgent)
+		}
+	}
+
+	if err = m.Revoke("another", s1.ID()); err == nil {
+		t.Error("expected error when revoking session of another user")
+	}
+	if err = m.Revoke("user", s1.ID()); err != nil {
+		t.Fatalf("cannot revoke session: %s", err)
+	}
+	if list, _ = m.List("user"); len(list) != 1 || list[0].ID != s2.ID() {
+		t.Fatalf("expected only %s left, got %+v", s2.ID(), list)
+	}
+
+	if err = m.RevokeAll("user"); err != nil {
+		t.Fatalf("cannot revoke sessions: %s", err)
+	}
+	if list, _ = m.List("user"); len(list) != 0 {
+		t.Fatalf("expected no session left, got %+v", list)
+	}
+}
@@ -1,11 +1,14 @@
 package session
 
 import (
+	"context"
 	"errors"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/Ronmi/rtoolkit/async"
 	"github.com/Ronmi/rtoolkit/session/store"
 )
 
@@ -40,16 +43,56 @@ func generateSeed() string {
 	return string(ret)
 }
 
+// ErrNotSupported indicates the store does not support requested feature
+var ErrNotSupported = store.ErrNotSupported
+
 // Manager is main session class
+//
+// TTL is idle timeout: session expires if it is not accessed within TTL
+// seconds. MaxAge is absolute timeout: session expires after MaxAge seconds
+// since created, no matter how often it is accessed. Each session can have
+// its own idle timeout, see Session.SetTTL.
+//
+// Per-session ttl and MaxAge require Store to implement store.TimedStore, they
+// are ignored if not.
+//
+// If Store implements store.ContextStore, store operations are cancelled when
+// context of the request is done. Other stores are adapted with
+// store.WithContext.
+//
+// Session id and seed are passed by Transport, which defaults to cookies.
+// Cookies are created by MakeCookie, then attributes in Cookie are applied.
+// Cookie.Prefix is prepended to Key and ChecksumKey. These cookie settings
+// are not used if Transport is set.
+//
+// Conflict decides what happens if concurrent requests of same session modify
+// session data, see ConflictPolicy for detail.
+//
+// Defaults are filled at first use, fields MUST NOT be changed and Manager
+// MUST NOT be copied after that.
 type Manager struct {
-	Store       store.Store // default to store.InMemory
-	Key         string      // default to "SESSION_ID", this is used in cookie
-	ChecksumKey string      // default to "SESSION_CHECK", this is used in cookie
-	TTL         int         // default to 7200 (2 hours)
-	MakeCookie  CookieMaker // default to DefaultCookieMaker
+	Store       store.Store    // default to store.InMemory
+	Key         string         // default to "SESSION_ID", this is used in cookie
+	ChecksumKey string         // default to "SESSION_CHECK", this is used in cookie
+	TTL         int            // default to 7200 (2 hours)
+	MaxAge      int            // default to 0 (no limit)
+	MakeCookie  CookieMaker    // default to DefaultCookieMaker
+	Cookie      CookieOptions  // default to zero value
+	Transport   Transport      // default to pass by cookies
+	Conflict    ConflictPolicy // default to ConflictOverwrite
+	Merge       MergeFunc      // used by ConflictMerge
+
+	once    sync.Once // fills defaults, see init()
+	locks   *async.LockGroup
+	hlock   sync.Mutex          // protects holders
+	holders map[string]*Session // session id => session holding the lock
 }
 
 func (m *Manager) init() {
+	m.once.Do(m.setDefault)
+}
+
+func (m *Manager) setDefault() {
 	if m.TTL <= 0 {
 		m.TTL = 7200
 	}
@@ -69,42 +112,108 @@ func (m *Manager) init() {
 	if m.MakeCookie == nil {
 		m.MakeCookie = DefaultCookieMaker
 	}
+
+	if m.Transport == nil {
+		m.Transport = cookieTransport{m: m}
+	}
+
+	if m.Conflict == ConflictLock {
+		m.locks = async.NewLockGroup()
+		m.holders = map[string]*Session{}
+	}
 }
 
 // Start begins or resumes a session, returns error if not found, seed
 // mismatch or something goes wrong.
 //
-// It reads session id and seed from cookie, creates one if no relevent
-// cookies found, or loads from store if cookies are set.
+// It reads session id and seed using Transport (cookie by default), creates
+// one if not found, or loads from store if found.
 //
 // It's caller's response to decide what to do if session has expired
 // or not found.
+//
+// If Conflict is ConflictLock, you SHOULD call Session.Close() when done. It
+// returns ctx.Err() if context of r is done before the lock is acquired.
+// Starting the session again in same request (r, or the request passed to
+// handler by NewMiddleware) does not wait for the lock, and returned session
+// is not locked.
+//
+// Store operations are done with context of r, including those made by
+// returned session.
 func (m *Manager) Start(w http.ResponseWriter, r *http.Request) (sess *Session, err error) {
 	m.init()
-	sid, err := r.Cookie(m.Key)
+	sid, seed := m.Transport.Read(r)
+
+	if sid == "" || seed == "" {
+		return newSession(r.Context(), m, w, r)
+	}
 
-	if err != nil || sid.Value == "" {
-		return newSession(m, w)
+	sess, err = load(sid, seed, m, w, r)
+	if err != nil {
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return newSession(r.Context(), m, w, r)
 	}
 
-	seed, err := r.Cookie(m.ChecksumKey)
+	return
+}
 
-	if err != nil || seed.Value == "" {
-		return newSession(m, w)
+// store returns context-aware version of m.Store
+func (m *Manager) store() store.ContextStore {
+	return store.WithContext(m.Store)
+}
+
+// timed reports whether m.Store records lifetime of each session
+func (m *Manager) timed() bool {
+	switch m.Store.(type) {
+	case store.TimedStore, store.ContextStore:
+		return true
 	}
+	return false
+}
 
-	sess, err = loadSession(sid.Value, seed.Value, m, w)
-	if err != nil {
-		return newSession(m, w)
+func (m *Manager) allocate(ctx context.Context, seed string) (id string, info store.Info, err error) {
+	info = store.Info{
+		Created: time.Now(),
+		TTL:     m.TTL,
+	}
+	if m.timed() {
+		info.MaxAge = m.MaxAge
 	}
 
+	id, err = m.store().AllocateContext(ctx, seed, m.TTL, m.MaxAge)
+	return
+}
+
+func (m *Manager) get(ctx context.Context, id string) (seed, data string, info store.Info, err error) {
+	seed, data, info, err = m.store().GetContext(ctx, id)
+	if info.TTL == 0 {
+		// store does not record lifetime
+		info.TTL = m.TTL
+	}
 	return
 }
 
 // New forces create a new session
+//
+// As request is not available, Secure attribute of cookies is set only if
+// Cookie.Secure is SecureAlways or required by other options.
 func (m *Manager) New(w http.ResponseWriter) (sess *Session, err error) {
+	return m.NewContext(context.Background(), w)
+}
+
+// NewContext is identical to New, but store operations are done with ctx,
+// including those made by returned session.
+func (m *Manager) NewContext(ctx context.Context, w http.ResponseWriter) (sess *Session, err error) {
 	m.init()
-	return newSession(m, w)
+	return newSession(ctx, m, w, nil)
+}
+
+func (m *Manager) makeCookie(name, value string, ttl int, secure bool) *http.Cookie {
+	c := m.MakeCookie(m.Cookie.name(name), value, ttl)
+	m.Cookie.apply(c, secure)
+	return c
 }
 
 // Session represents session for a specific client
@@ -112,14 +221,18 @@ type Session struct {
 	id      string
 	seed    string
 	data    string
+	info    store.Info
+	r       *http.Request // request which starts the session, might be nil
+	ctx     context.Context
 	expired bool
 	saved   bool
+	unlock  func() // releases per-session lock, nil if not locked
 	m       *Manager
 }
 
-func newSession(m *Manager, w http.ResponseWriter) (*Session, error) {
+func newSession(ctx context.Context, m *Manager, w http.ResponseWriter, r *http.Request) (*Session, error) {
 	seed := generateSeed()
-	id, err := m.Store.Allocate(seed)
+	id, info, err := m.allocate(ctx, seed)
 	if err != nil {
 		return nil, err
 	}
@@ -127,22 +240,18 @@ func newSession(m *Manager, w http.ResponseWriter) (*Session, error) {
 	s := &Session{
 		id:   id,
 		seed: seed,
+		info: info,
+		r:    r,
+		ctx:  ctx,
 		m:    m,
 	}
-	defer s.Save(w)
-
-	// session id
-	c := m.MakeCookie(s.m.Key, s.id, s.m.TTL)
-	http.SetCookie(w, c)
-	// session checksum
-	c = m.MakeCookie(s.m.ChecksumKey, seed, s.m.TTL)
-	http.SetCookie(w, c)
+	s.Save(w) // writes session id and seed
 
 	return s, nil
 }
 
-func loadSession(id, seed string, m *Manager, w http.ResponseWriter) (*Session, error) {
-	expect, data, err := m.Store.Get(id)
+func loadSession(id, seed string, m *Manager, w http.ResponseWriter, r *http.Request) (*Session, error) {
+	expect, data, info, err := m.get(r.Context(), id)
 	if err != nil {
 		return nil, err
 	}
@@ -155,19 +264,56 @@ func loadSession(id, seed string, m *Manager, w http.ResponseWriter) (*Session,
 		id:   id,
 		seed: seed,
 		data: data,
+		info: info,
+		r:    r,
+		ctx:  r.Context(),
 		m:    m,
 	}
-	c := m.MakeCookie(s.m.Key, s.id, s.m.TTL)
-	http.SetCookie(w, c)
+	m.Transport.Write(w, r, s.id, s.seed, s.ttlLeft())
+	return s, nil
+}
+
+// load loads session with per-session lock acquired
+func load(id, seed string, m *Manager, w http.ResponseWriter, r *http.Request) (*Session, error) {
+	if m.Conflict != ConflictLock {
+		return loadSession(id, seed, m, w, r)
+	}
+
+	if m.holding(id, r) {
+		// started by same request, which holds the lock
+		return loadSession(id, seed, m, w, r)
+	}
+
+	if err := m.locks.LockContext(r.Context(), id); err != nil {
+		return nil, err
+	}
+	s, err := loadSession(id, seed, m, w, r)
+	if err != nil {
+		m.locks.Unlock(id)
+		return nil, err
+	}
+
+	m.hold(s)
 	return s, nil
 }
 
+// ttlLeft computes how long client should keep session id, respects both
+// idle and absolute timeout
+func (s *Session) ttlLeft() int {
+	now := time.Now()
+	ret := int(s.info.ExpireAt(now).Sub(now) / time.Second)
+	if ret <= 0 {
+		return -1
+	}
+	return ret
+}
+
 // ID returns session id
 func (s *Session) ID() string {
 	return s.id
 }
 
-// Destroy sets this session as expired and expires cookie
+// Destroy sets this session as expired and expires cookies
 //
 // Calling Destroy() after Save() is a no-op.
 // Since it sets cookie, yu SHOULD call it before w.Write().
@@ -177,40 +323,82 @@ func (s *Session) Destroy(w http.ResponseWriter) {
 	}
 
 	s.expired = true
-	s.m.Store.Release(s.id)
-	c := s.m.MakeCookie(s.m.Key, "", s.m.TTL)
-	http.SetCookie(w, c)
+	_ = s.m.store().ReleaseContext(s.ctx, s.id)
+	s.m.Transport.Write(w, s.r, "", "", -1)
 	s.saved = true
 }
 
 // Save saves data, updates cookie expire time, and delete cookie or session if expired
 //
+// With ConflictFail or ConflictMerge policy, data has been saved by
+// SetData(), so Save() only updates cookie.
+//
 // Calling Save() after Destroy() is a no-op.
 // Since it sets cookie, you SHOULD call it before w.Write().
 func (s *Session) Save(w http.ResponseWriter) error {
+	return s.SaveContext(s.ctx, w)
+}
+
+// SaveContext is identical to Save, but store operation is done with ctx
+func (s *Session) SaveContext(ctx context.Context, w http.ResponseWriter) error {
 	if s.saved {
 		return nil
 	}
 
-	err := s.m.Store.Set(s.id, s.seed, s.data)
+	var err error
+	if s.m.Conflict == ConflictOverwrite || s.m.Conflict == ConflictLock {
+		err = s.m.store().SetContext(ctx, s.id, s.seed, s.data)
+	}
 	if err == nil {
-		c := s.m.MakeCookie(s.m.Key, s.id, s.m.TTL)
-		http.SetCookie(w, c)
-		c = s.m.MakeCookie(s.m.ChecksumKey, s.seed, s.m.TTL)
-		http.SetCookie(w, c)
+		s.m.Transport.Write(w, s.r, s.id, s.seed, s.ttlLeft())
 		s.saved = true
 	}
 	return err
 }
 
+// Created returns the time when this session was created
+//
+// It returns zero time if the store does not implement store.TimedStore.
+func (s *Session) Created() time.Time {
+	return s.info.Created
+}
+
+// TTL returns idle timeout of this session, in seconds
+func (s *Session) TTL() int {
+	return s.info.TTL
+}
+
+// SetTTL changes idle timeout of this session, and refreshes it. Absolute
+// timeout (Manager.MaxAge) is not affected.
+//
+// It is useful to implement "remember me" function:
+//
+//     if param.RememberMe {
+//         sess.SetTTL(30 * 86400)
+//     }
+//
+// It returns ErrNotSupported if the store does not implement
+// store.TimedStore. Cookies are updated when Save().
+func (s *Session) SetTTL(ttl int) error {
+	err := s.m.store().SetSessionTTLContext(s.ctx, s.id, ttl)
+	if err == nil {
+		s.saved = false
+		s.info.TTL = ttl
+	}
+
+	return err
+}
+
 // Data returns session data
 func (s *Session) Data() string {
 	return s.data
 }
 
 // SetDate updates session data, yu need Save() to save it into session storage
+//
+// It might return ErrConflict, depends on Manager.Conflict.
 func (s *Session) SetData(data string) error {
-	err := s.m.Store.Set(s.id, s.seed, data)
+	data, err := s.write(data)
 	if err == nil {
 		s.saved = false
 		s.expired = false
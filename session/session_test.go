@@ -0,0 +1,120 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// forward copies cookies set in response to a new request
+func forward(w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestManagerResume(t *testing.T) {
+	m := &Manager{}
+	w := httptest.NewRecorder()
+	sess, err := m.Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+	if err = sess.SetData("data"); err != nil {
+		t.Fatalf("cannot set data: %s", err)
+	}
+	if err = sess.Save(w); err != nil {
+		t.Fatalf("cannot save session: %s", err)
+	}
+
+	actual, err := m.Start(httptest.NewRecorder(), forward(w))
+	if err != nil {
+		t.Fatalf("cannot resume session: %s", err)
+	}
+	if actual.ID() != sess.ID() {
+		t.Errorf("expected session %s, got %s", sess.ID(), actual.ID())
+	}
+	if actual.Data() != "data" {
+		t.Errorf("expected data to be `data`, got `%s`", actual.Data())
+	}
+	if actual.Created().IsZero() {
+		t.Error("expected creation time to be recorded")
+	}
+}
+
+func TestManagerMaxAge(t *testing.T) {
+	m := &Manager{TTL: 10, MaxAge: 1}
+	w := httptest.NewRecorder()
+	sess, err := m.Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+
+	for _, c := range w.Result().Cookies() {
+		if c.MaxAge > 1 {
+			t.Errorf("expected max age of cookie %s <= 1, got %d", c.Name, c.MaxAge)
+		}
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	actual, err := m.Start(httptest.NewRecorder(), forward(w))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+	if actual.ID() == sess.ID() {
+		t.Error("expected a new session after max age")
+	}
+}
+
+func TestSessionSetTTL(t *testing.T) {
+	m := &Manager{TTL: 1}
+	w := httptest.NewRecorder()
+	sess, err := m.Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+
+	if err = sess.SetTTL(3); err != nil {
+		t.Fatalf("cannot set ttl: %s", err)
+	}
+	w = httptest.NewRecorder()
+	if err = sess.Save(w); err != nil {
+		t.Fatalf("cannot save session: %s", err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	actual, err := m.Start(httptest.NewRecorder(), forward(w))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+	if actual.ID() != sess.ID() {
+		t.Error("expected session to be remembered")
+	}
+	if actual.TTL() != 3 {
+		t.Errorf("expected ttl to be 3, got %d", actual.TTL())
+	}
+}
+
+func TestManagerContext(t *testing.T) {
+	m := &Manager{}
+	w := httptest.NewRecorder()
+	sess, err := m.Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = m.Start(httptest.NewRecorder(), forward(w).WithContext(ctx)); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	sess.SetData("data")
+	if err = sess.SaveContext(ctx, httptest.NewRecorder()); err != context.Canceled {
+		t.Errorf("expected context.Canceled when saving, got %v", err)
+	}
+}
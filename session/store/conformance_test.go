@@ -0,0 +1,31 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/Ronmi/rtoolkit/session/store"
+	"github.com/Ronmi/rtoolkit/session/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("InMemory", func(t *testing.T) {
+		t.Parallel()
+		storetest.Run(t, func() store.Store {
+			return store.InMemory(60)
+		})
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		t.Parallel()
+		storetest.Run(t, func() store.Store {
+			return store.NewMemory(60, store.MemoryOptions{Capacity: 1000})
+		})
+	})
+
+	t.Run("Layered", func(t *testing.T) {
+		t.Parallel()
+		storetest.Run(t, func() store.Store {
+			return store.Layered(store.InMemory(60), 100)
+		})
+	})
+}
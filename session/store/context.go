@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotSupported is returned by adapter created with WithContext, if the
+// store does not support requested feature
+var ErrNotSupported = errors.New("rtoolkit/session/store: operation not supported by store")
+
+// ContextStore is like a VersionedStore and IndexedStore, but every operation
+// accepts a context, so it can be cancelled or time out with the request.
+//
+// Implementations SHOULD return ctx.Err() as soon as possible when ctx is
+// done, and follow rules of corresponding methods in Store, TimedStore,
+// VersionedStore and IndexedStore.
+//
+// Stores in sub packages implement it, use WithContext to adapt others.
+type ContextStore interface {
+	// SetTTL decides how long before data to be considered invalid (in seconds)
+	SetTTL(ttl int)
+
+	// AllocateContext creates a new session id, see TimedStore.AllocateTimed
+	AllocateContext(ctx context.Context, seed string, ttl, maxAge int) (string, error)
+
+	// GetContext returns session data and refreshes ttl, see
+	// TimedStore.GetTimed
+	GetContext(ctx context.Context, sessID string) (seed, data string, info Info, err error)
+
+	// SetContext saves session data and refreshes ttl, see Store.Set
+	SetContext(ctx context.Context, sessID, seed, data string) error
+
+	// SetVersionContext saves session data if current version is ver, see
+	// VersionedStore.SetVersion
+	SetVersionContext(ctx context.Context, sessID, seed, data string, ver int64) error
+
+	// SetSessionTTLContext changes idle timeout of a session, see
+	// TimedStore.SetSessionTTL
+	SetSessionTTLContext(ctx context.Context, sessID string, ttl int) error
+
+	// ReleaseContext clears a session, see Store.Release
+	//
+	// Unlike Release, it returns error if something goes wrong, including
+	// cancelled context.
+	ReleaseContext(ctx context.Context, sessID string) error
+
+	// BindContext associates a session with owner, see IndexedStore.Bind
+	BindContext(ctx context.Context, sessID, owner, ip, userAgent string) error
+
+	// ListContext returns active sessions of the owner, see IndexedStore.List
+	ListContext(ctx context.Context, owner string) ([]Meta, error)
+
+	// ReleaseAllContext clears all sessions of the owner, see
+	// IndexedStore.ReleaseAll
+	ReleaseAllContext(ctx context.Context, owner string) error
+}
+
+// WithContext adapts s into a ContextStore. It returns s directly if it
+// implements ContextStore.
+//
+// Created adapter checks ctx before calling methods of s, which cannot be
+// cancelled once started. It falls back to methods of Store if s does not
+// implement TimedStore (ttl and maxAge are ignored, Info is zero value), and
+// returns ErrNotSupported if s does not implement VersionedStore or
+// IndexedStore.
+func WithContext(s Store) ContextStore {
+	if ret, ok := s.(ContextStore); ok {
+		return ret
+	}
+
+	return ctxStore{s}
+}
+
+type ctxStore struct {
+	Store
+}
+
+func (s ctxStore) AllocateContext(ctx context.Context, seed string, ttl, maxAge int) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if ts, ok := s.Store.(TimedStore); ok {
+		return ts.AllocateTimed(seed, ttl, maxAge)
+	}
+	return s.Allocate(seed)
+}
+
+func (s ctxStore) GetContext(ctx context.Context, sessID string) (seed, data string, info Info, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	if ts, ok := s.Store.(TimedStore); ok {
+		return ts.GetTimed(sessID)
+	}
+	seed, data, err = s.Get(sessID)
+	return
+}
+
+func (s ctxStore) SetContext(ctx context.Context, sessID, seed, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.Set(sessID, seed, data)
+}
+
+func (s ctxStore) SetVersionContext(ctx context.Context, sessID, seed, data string, ver int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	vs, ok := s.Store.(VersionedStore)
+	if !ok {
+		return ErrNotSupported
+	}
+	return vs.SetVersion(sessID, seed, data, ver)
+}
+
+func (s ctxStore) SetSessionTTLContext(ctx context.Context, sessID string, ttl int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ts, ok := s.Store.(TimedStore)
+	if !ok {
+		return ErrNotSupported
+	}
+	return ts.SetSessionTTL(sessID, ttl)
+}
+
+func (s ctxStore) ReleaseContext(ctx context.Context, sessID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.Release(sessID)
+	return nil
+}
+
+func (s ctxStore) BindContext(ctx context.Context, sessID, owner, ip, userAgent string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	is, ok := s.Store.(IndexedStore)
+	if !ok {
+		return ErrNotSupported
+	}
+	return is.Bind(sessID, owner, ip, userAgent)
+}
+
+func (s ctxStore) ListContext(ctx context.Context, owner string) ([]Meta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	is, ok := s.Store.(IndexedStore)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return is.List(owner)
+}
+
+func (s ctxStore) ReleaseAllContext(ctx context.Context, owner string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	is, ok := s.Store.(IndexedStore)
+	if !ok {
+		return ErrNotSupported
+	}
+	return is.ReleaseAll(owner)
+}
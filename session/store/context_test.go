@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// basicStore hides extensions of a store
+type basicStore struct {
+	Store
+}
+
+func TestWithContext(t *testing.T) {
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+	ctx := context.Background()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	t.Run("timed", func(t *testing.T) {
+		s := WithContext(InMemory(10))
+		id, err := s.AllocateContext(ctx, seed, 20, 30)
+		if err != nil {
+			t.Fatalf("cannot allocate: %s", err)
+		}
+
+		_, _, info, err := s.GetContext(ctx, id)
+		if err != nil {
+			t.Fatalf("cannot get: %s", err)
+		}
+		if info.TTL != 20 || info.MaxAge != 30 {
+			t.Errorf("unexpected info: %+v", info)
+		}
+
+		if err = s.SetContext(canceled, id, seed, "data"); err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if _, _, _, err = s.GetContext(canceled, id); err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if err = s.ReleaseContext(canceled, id); err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if _, _, _, err = s.GetContext(ctx, id); err != nil {
+			t.Errorf("session should not be released: %s", err)
+		}
+	})
+
+	t.Run("basic", func(t *testing.T) {
+		s := WithContext(basicStore{InMemory(10)})
+		id, err := s.AllocateContext(ctx, seed, 20, 30)
+		if err != nil {
+			t.Fatalf("cannot allocate: %s", err)
+		}
+
+		_, _, info, err := s.GetContext(ctx, id)
+		if err != nil {
+			t.Fatalf("cannot get: %s", err)
+		}
+		if info != (Info{}) {
+			t.Errorf("expected zero info, got %+v", info)
+		}
+
+		if err = s.SetVersionContext(ctx, id, seed, "data", 0); err != ErrNotSupported {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+		if err = s.BindContext(ctx, id, "owner", "", ""); err != ErrNotSupported {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+	})
+}
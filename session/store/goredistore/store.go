@@ -1,15 +1,29 @@
 // package goredistore implements Redis based session store using go-redis/redis
 //
-// Since seed length is fixed, storing data is simplified to only one command:
+// Each session is stored in a hash, with following fields:
 //
-//      redis.Set(sessionID, seed+data, ttl)
+//      seed, data, created, ttl, max_age, seen, ver, owner, ip, ua
 //
-// But reading data need two command, one for refreshing ttl, one for getting
-// data.
+// Expiration of the hash key is refreshed with ttl of the session, and
+// limited by max age. Sessions of an owner are indexed in a set named
+// "owner:" + owner. Both keys are prefixed with GoRedisStore.Prefix.
+//
+// Reading or writing a session is done by a Lua script, which checks,
+// refreshes and returns the session atomically in one round trip. Every
+// script touches only one key, so it works with Redis Cluster. Updating owner
+// index is not atomic, List cleans up expired sessions in the index.
+//
+// GoRedisStore implements store.ContextStore, but go-redis v6 does not cancel
+// commands which have been sent. Context is checked before each operation, and
+// passed to client (see redis.Client.Context) so hooks like WrapProcess can
+// use it. Set ReadTimeout and WriteTimeout in redis.Options to limit time
+// spent on a command.
 package goredistore
 
 import (
+	"context"
 	"errors"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,27 +31,199 @@ import (
 	"github.com/go-redis/redis"
 )
 
+var errFormat = errors.New("rtoolkit/session/store/goredis: incorrect format data detected in store")
+
+// ErrNotFound is returned if the session does not exist or has expired. Other
+// errors are returned by go-redis, like network errors.
+var ErrNotFound = errors.New("rtoolkit/session/store/goredis: session not exists")
+
+// computes expire time (in milliseconds) of the session key
+const luaExpireAt = `
+local function expire_at(key, now)
+  local v = redis.call('HMGET', key, 'created', 'ttl', 'max_age')
+  local exp = now + tonumber(v[2]) * 1000
+  local max_age = tonumber(v[3])
+  if max_age > 0 then
+    local deadline = (tonumber(v[1]) + max_age) * 1000
+    if deadline < exp then
+      exp = deadline
+    end
+  end
+  return exp
+end
+`
+
+// KEYS[1]: session key
+// ARGV[1]: expire time (in milliseconds), ARGV[2..]: field, value pairs
+var scriptAllocate = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  return 0
+end
+redis.call('HMSET', KEYS[1], unpack(ARGV, 2))
+redis.call('PEXPIREAT', KEYS[1], ARGV[1])
+return 1
+`)
+
+// KEYS[1]: session key
+// ARGV[1]: current time (in milliseconds)
+//
+// returns all fields, or nil if not found
+var scriptGet = redis.NewScript(luaExpireAt + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return false
+end
+local now = tonumber(ARGV[1])
+local exp = expire_at(KEYS[1], now)
+if exp <= now then
+  redis.call('DEL', KEYS[1])
+  return false
+end
+redis.call('HSET', KEYS[1], 'seen', math.floor(now / 1000))
+redis.call('PEXPIREAT', KEYS[1], exp)
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// KEYS[1]: session key
+// ARGV[1]: current time (in milliseconds), ARGV[2]: expected version, or
+// empty string to skip the check, ARGV[3]: "1" to increase version,
+// ARGV[4..]: field, value pairs
+//
+// returns 1 if succeeded, 0 if not found, -1 if version mismatch
+var scriptUpdate = redis.NewScript(luaExpireAt + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return 0
+end
+if ARGV[2] ~= '' and redis.call('HGET', KEYS[1], 'ver') ~= ARGV[2] then
+  return -1
+end
+local now = tonumber(ARGV[1])
+if #ARGV > 3 then
+  redis.call('HMSET', KEYS[1], unpack(ARGV, 4))
+end
+local exp = expire_at(KEYS[1], now)
+if exp <= now then
+  redis.call('DEL', KEYS[1])
+  return 0
+end
+if ARGV[3] == '1' then
+  redis.call('HINCRBY', KEYS[1], 'ver', 1)
+end
+redis.call('HSET', KEYS[1], 'seen', math.floor(now / 1000))
+redis.call('PEXPIREAT', KEYS[1], exp)
+return 1
+`)
+
+// parse converts fields of session hash into session data
+func parse(sessID string, m map[string]string) (seed, data string, meta store.Meta, err error) {
+	if m["seed"] == "" {
+		// not exist, or expired while reading
+		err = ErrNotFound
+		return
+	}
+
+	var nums [5]int64
+	for x, k := range []string{"created", "ttl", "max_age", "seen", "ver"} {
+		if nums[x], err = strconv.ParseInt(m[k], 10, 64); err != nil {
+			err = errFormat
+			return
+		}
+	}
+
+	seed = m["seed"]
+	data = m["data"]
+	meta = store.Meta{
+		Info: store.Info{
+			Created: time.Unix(nums[0], 0),
+			TTL:     int(nums[1]),
+			MaxAge:  int(nums[2]),
+			Version: nums[4],
+		},
+		ID:        sessID,
+		Owner:     m["owner"],
+		LastSeen:  time.Unix(nums[3], 0),
+		IP:        m["ip"],
+		UserAgent: m["ua"],
+	}
+	return
+}
+
+// toMap converts result of HGETALL returned by Lua script into map
+func toMap(v interface{}) (map[string]string, error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr)%2 != 0 {
+		return nil, errFormat
+	}
+
+	ret := make(map[string]string, len(arr)/2)
+	for x := 0; x < len(arr); x += 2 {
+		k, ok1 := arr[x].(string)
+		v, ok2 := arr[x+1].(string)
+		if !ok1 || !ok2 {
+			return nil, errFormat
+		}
+		ret[k] = v
+	}
+
+	return ret, nil
+}
+
+func now() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// GoRedisStore is a session store using go-redis/redis
+//
+// Set UniversalClient to use any kind of client supported by go-redis, like
+// cluster, sentinel (failover) or ring:
+//
+//     s := &goredistore.GoRedisStore{
+//         UniversalClient: redis.NewUniversalClient(&redis.UniversalOptions{
+//             Addrs:      []string{":26379"},
+//             MasterName: "master",
+//         }),
+//         Prefix: "myapp:session:",
+//     }
+//
+// A single node client is created from Options if UniversalClient is nil.
+//
+// Prefix is prepended to every key, so multiple apps can share same Redis.
 type GoRedisStore struct {
 	*redis.Options
-	client *redis.Client
-	lock   sync.Mutex
+	UniversalClient redis.UniversalClient
+	Prefix          string
+	lock            sync.Mutex
 
 	ttl time.Duration
 }
 
-// GetClient returns go-redis client instance
-func (s *GoRedisStore) GetClient() *redis.Client {
-	if s.client != nil {
-		return s.client
+// Client returns go-redis client instance
+func (s *GoRedisStore) Client() redis.UniversalClient {
+	if s.UniversalClient != nil {
+		return s.UniversalClient
 	}
 
 	// ensure only one thread can create connection
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	if s.client == nil {
-		s.client = redis.NewClient(s.Options)
+	if s.UniversalClient == nil {
+		s.UniversalClient = redis.NewClient(s.Options)
 	}
-	return s.client
+	return s.UniversalClient
+}
+
+// GetClient returns go-redis client instance if it is a single node client,
+// or nil for other kinds of client (see Client)
+func (s *GoRedisStore) GetClient() *redis.Client {
+	c, _ := s.Client().(*redis.Client)
+	return c
+}
+
+func (s *GoRedisStore) key(sessID string) string {
+	return s.Prefix + sessID
+}
+
+func (s *GoRedisStore) ownerKey(owner string) string {
+	return s.Prefix + "owner:" + owner
 }
 
 func (s *GoRedisStore) SetTTL(ttl int) {
@@ -45,47 +231,301 @@ func (s *GoRedisStore) SetTTL(ttl int) {
 }
 
 func (s *GoRedisStore) Allocate(seed string) (string, error) {
-	c := s.GetClient()
+	return s.AllocateTimed(seed, int(s.ttl/time.Second), 0)
+}
+
+func (s *GoRedisStore) AllocateTimed(seed string, ttl, maxAge int) (string, error) {
+	c := s.Client()
+	info := store.Info{
+		Created: time.Now(),
+		TTL:     ttl,
+		MaxAge:  maxAge,
+	}
+	exp := info.ExpireAt(info.Created).UnixNano() / int64(time.Millisecond)
+	args := []interface{}{
+		exp,
+		"seed", seed,
+		"data", "",
+		"created", info.Created.Unix(),
+		"ttl", ttl,
+		"max_age", maxAge,
+		"seen", info.Created.Unix(),
+		"ver", 0,
+	}
+
 	var err error
 	id := store.GenerateRandomKey(32, func(id string) bool {
-		var ret bool
-		ret, err = c.SetNX(id, seed, s.ttl).Result()
-		if err != nil {
-			return true
-		}
-
-		return ret
+		var ret int64
+		ret, err = scriptAllocate.Run(c, []string{s.key(id)}, args...).Int64()
+		return err != nil || ret == 1
 	})
 
 	return id, err
 }
 
+// load reads session data without refreshing ttl
+func (s *GoRedisStore) load(sessID string) (seed, data string, meta store.Meta, err error) {
+	m, err := s.Client().HGetAll(s.key(sessID)).Result()
+	if err != nil {
+		return
+	}
+
+	return parse(sessID, m)
+}
+
+// update writes fields and refreshes a session, increases version if data is
+// written. ver is expected version, empty string to skip the check.
+func (s *GoRedisStore) update(sessID, ver string, fields ...interface{}) error {
+	incr := "0"
+	for x := 0; x < len(fields); x += 2 {
+		if fields[x] == "data" {
+			incr = "1"
+		}
+	}
+
+	args := append([]interface{}{now(), ver, incr}, fields...)
+	ret, err := scriptUpdate.Run(s.Client(), []string{s.key(sessID)}, args...).Int64()
+	if err != nil {
+		return err
+	}
+
+	switch ret {
+	case 0:
+		return ErrNotFound
+	case -1:
+		return store.ErrConflict
+	}
+	return nil
+}
+
 func (s *GoRedisStore) Get(sessID string) (seed, data string, err error) {
-	c := s.GetClient()
-	if _, err := c.Expire(sessID, s.ttl).Result(); err != nil {
-		return "", "", err
+	seed, data, _, err = s.GetTimed(sessID)
+	return
+}
+
+func (s *GoRedisStore) GetTimed(sessID string) (seed, data string, info store.Info, err error) {
+	v, err := scriptGet.Run(s.Client(), []string{s.key(sessID)}, now()).Result()
+	if err == redis.Nil {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return
 	}
 
-	str, err := c.Get(sessID).Result()
+	m, err := toMap(v)
 	if err != nil {
-		return "", "", err
+		return
 	}
 
-	if len(str) < store.SeedLength {
-		return "", "", errors.New("rtoolkit/session/store/goredis: incorrect format data detected in store")
+	seed, data, meta, err := parse(sessID, m)
+	if err != nil {
+		return
 	}
 
-	return str[:store.SeedLength], str[store.SeedLength:], err
+	return seed, data, meta.Info, nil
 }
 
 func (s *GoRedisStore) Set(sessID, seed, data string) error {
-	c := s.GetClient()
+	return s.update(sessID, "", "seed", seed, "data", data)
+}
 
-	_, err := c.SetXX(sessID, seed+data, s.ttl).Result()
-	return err
+func (s *GoRedisStore) SetVersion(sessID, seed, data string, ver int64) error {
+	return s.update(sessID, strconv.FormatInt(ver, 10), "seed", seed, "data", data)
+}
+
+func (s *GoRedisStore) SetSessionTTL(sessID string, ttl int) error {
+	return s.update(sessID, "", "ttl", ttl)
 }
 
 func (s *GoRedisStore) Release(sessID string) {
-	s.GetClient().Expire(sessID, time.Duration(-1)*time.Second)
+	_ = s.release(sessID)
+}
+
+func (s *GoRedisStore) release(sessID string) error {
+	c := s.Client()
+	owner, err := c.HGet(s.key(sessID), "owner").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	if err = c.Del(s.key(sessID)).Err(); err != nil || owner == "" {
+		return err
+	}
+	return c.SRem(s.ownerKey(owner), sessID).Err()
+}
+
+func (s *GoRedisStore) Bind(sessID, owner, ip, userAgent string) error {
+	_, _, meta, err := s.load(sessID)
+	if err != nil {
+		return err
+	}
+
+	c := s.Client()
+	if meta.Owner != "" && meta.Owner != owner {
+		if err = c.SRem(s.ownerKey(meta.Owner), sessID).Err(); err != nil {
+			return err
+		}
+	}
+
+	err = s.update(sessID, "", "owner", owner, "ip", ip, "ua", userAgent)
+	if err != nil || owner == "" {
+		return err
+	}
+
+	return c.SAdd(s.ownerKey(owner), sessID).Err()
+}
+
+func (s *GoRedisStore) List(owner string) ([]store.Meta, error) {
+	c := s.Client()
+	ids, err := c.SMembers(s.ownerKey(owner)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	_, err = c.Pipelined(func(p redis.Pipeliner) error {
+		for x, id := range ids {
+			cmds[x] = p.HGetAll(s.key(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]store.Meta, 0, len(ids))
+	for x, id := range ids {
+		_, _, meta, err := parse(id, cmds[x].Val())
+		if err != nil || meta.Owner != owner {
+			// expired session, clean up index
+			c.SRem(s.ownerKey(owner), id)
+			continue
+		}
+
+		ret = append(ret, meta)
+	}
+
+	return ret, nil
+}
+
+func (s *GoRedisStore) ReleaseAll(owner string) error {
+	c := s.Client()
+	ids, err := c.SMembers(s.ownerKey(owner)).Result()
+	if err != nil {
+		return err
+	}
+
+	// keys might be in different slots of a cluster, delete them one by one
+	_, err = c.Pipelined(func(p redis.Pipeliner) error {
+		for _, id := range ids {
+			p.Del(s.key(id))
+		}
+		p.Del(s.ownerKey(owner))
+		return nil
+	})
+	return err
+}
+
+// withContext checks ctx, and returns a copy of s sending commands with ctx
+func (s *GoRedisStore) withContext(ctx context.Context) (*GoRedisStore, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c := s.Client()
+	switch x := c.(type) {
+	case *redis.Client:
+		c = x.WithContext(ctx)
+	case *redis.ClusterClient:
+		c = x.WithContext(ctx)
+	case *redis.Ring:
+		c = x.WithContext(ctx)
+	}
+
+	return &GoRedisStore{
+		UniversalClient: c,
+		Prefix:          s.Prefix,
+		ttl:             s.ttl,
+	}, nil
+}
+
+func (s *GoRedisStore) AllocateContext(ctx context.Context, seed string, ttl, maxAge int) (string, error) {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return c.AllocateTimed(seed, ttl, maxAge)
+}
+
+func (s *GoRedisStore) GetContext(ctx context.Context, sessID string) (seed, data string, info store.Info, err error) {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return
+	}
+
+	return c.GetTimed(sessID)
+}
+
+func (s *GoRedisStore) SetContext(ctx context.Context, sessID, seed, data string) error {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.Set(sessID, seed, data)
+}
+
+func (s *GoRedisStore) SetVersionContext(ctx context.Context, sessID, seed, data string, ver int64) error {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.SetVersion(sessID, seed, data, ver)
+}
+
+func (s *GoRedisStore) SetSessionTTLContext(ctx context.Context, sessID string, ttl int) error {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.SetSessionTTL(sessID, ttl)
+}
+
+func (s *GoRedisStore) ReleaseContext(ctx context.Context, sessID string) error {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.release(sessID)
+}
+
+func (s *GoRedisStore) BindContext(ctx context.Context, sessID, owner, ip, userAgent string) error {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.Bind(sessID, owner, ip, userAgent)
+}
+
+func (s *GoRedisStore) ListContext(ctx context.Context, owner string) ([]store.Meta, error) {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.List(owner)
+}
+
+func (s *GoRedisStore) ReleaseAllContext(ctx context.Context, owner string) error {
+	c, err := s.withContext(ctx)
+	if err != nil {
+		return err
+	}
 
+	return c.ReleaseAll(owner)
 }
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Ronmi/rtoolkit/session/store"
+	"github.com/Ronmi/rtoolkit/session/store/storetest"
 	"github.com/go-redis/redis"
 )
 
@@ -16,7 +17,7 @@ func genSeed() string {
 	return strings.Repeat(string(store.SeedChars[rand.Intn(len(store.SeedChars))]), store.SeedLength)
 }
 
-func TestStore(t *testing.T) {
+func options() *redis.Options {
 	constr := os.Getenv("REDIS_CONSTR")
 	if constr == "" {
 		log.Fatal("You must set constr in REDIS_CONSTR.")
@@ -27,8 +28,27 @@ func TestStore(t *testing.T) {
 		log.Fatalf("Invalid constr: %s", err)
 	}
 
+	return o
+}
+
+func TestConformance(t *testing.T) {
+	c := redis.NewClient(options())
+	t.Cleanup(func() { c.Close() })
+
+	storetest.Run(t, func() store.Store {
+		return &GoRedisStore{
+			UniversalClient: c,
+			Prefix:          "rtoolkit:conformance:",
+		}
+	})
+}
+
+func TestStore(t *testing.T) {
+	o := options()
+
 	s := &GoRedisStore{
 		Options: o,
+		Prefix:  "rtoolkit:test:",
 	}
 	s.SetTTL(1)
 
@@ -40,13 +60,13 @@ func TestStore(t *testing.T) {
 	}
 
 	c := s.GetClient()
-	str, err := c.Get(id).Result()
+	m, err := c.HGetAll(s.Prefix + id).Result()
 	if err != nil {
 		t.Fatalf("unexpected error when validating: %s", err)
 	}
 
-	if str != seed {
-		t.Fatalf("expect to get only seed data `%s` got `%s`", seed, str)
+	if m["seed"] != seed || m["data"] != "" {
+		t.Fatalf("expect to get only seed data `%s` got `%v`", seed, m)
 	}
 
 	aSeed, aData, err := s.Get(id)
@@ -89,9 +109,105 @@ func TestStore(t *testing.T) {
 
 		s.Release(id)
 
+		aSeed, aData, err := s.Get(id)
+		if err != ErrNotFound {
+			t.Fatalf("sesion not released, dumping data `%s`, seed `%s`, error %v", aData, aSeed, err)
+		}
+		if err = s.Set(id, seed, "data"); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound when setting, got %v", err)
+		}
+	})
+
+	t.Run("NetworkError", func(t *testing.T) {
+		bad := &GoRedisStore{
+			Options: &redis.Options{Addr: "127.0.0.1:1"},
+		}
+
+		_, _, err := bad.Get(id)
+		if err == nil || err == ErrNotFound {
+			t.Fatalf("expected network error, got %v", err)
+		}
+	})
+
+	t.Run("SetSessionTTL", func(t *testing.T) {
+		seed := genSeed()
+		id, _ := s.Allocate(seed)
+
+		if err := s.SetSessionTTL(id, 3); err != nil {
+			t.Fatalf("unexpected error when setting ttl: %s", err)
+		}
+
+		time.Sleep(s.ttl + time.Second)
+
+		_, _, info, err := s.GetTimed(id)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if info.TTL != 3 {
+			t.Fatalf("expected ttl to be 3, got %d", info.TTL)
+		}
+	})
+
+	t.Run("MaxAge", func(t *testing.T) {
+		seed := genSeed()
+		id, _ := s.AllocateTimed(seed, 10, 1)
+
+		time.Sleep(2 * time.Second)
+
 		aSeed, aData, err := s.Get(id)
 		if err == nil {
-			t.Fatalf("sesion not released, dumping data `%s`, seed `%s`", aData, aSeed)
+			t.Fatalf("sesion not expired, dumping data `%s`, seed `%s`", aData, aSeed)
+		}
+	})
+
+	t.Run("SetVersion", func(t *testing.T) {
+		seed := genSeed()
+		id, _ := s.Allocate(seed)
+
+		_, _, info, _ := s.GetTimed(id)
+		if err := s.SetVersion(id, seed, "a", info.Version); err != nil {
+			t.Fatalf("unexpected error when setting: %s", err)
+		}
+		if err := s.SetVersion(id, seed, "b", info.Version); err != store.ErrConflict {
+			t.Fatalf("expected conflict, got %v", err)
+		}
+
+		_, aData, aInfo, _ := s.GetTimed(id)
+		if aData != "a" || aInfo.Version != info.Version+1 {
+			t.Fatalf("expected data a at version %d, got %s at version %d", info.Version+1, aData, aInfo.Version)
+		}
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		owner := genSeed()
+		id1, _ := s.Allocate(genSeed())
+		id2, _ := s.Allocate(genSeed())
+
+		if err := s.Bind(id1, owner, "127.0.0.1", "agent"); err != nil {
+			t.Fatalf("unexpected error when binding: %s", err)
+		}
+		if err := s.Bind(id2, owner, "127.0.0.1", "agent"); err != nil {
+			t.Fatalf("unexpected error when binding: %s", err)
+		}
+
+		list, err := s.List(owner)
+		if err != nil {
+			t.Fatalf("unexpected error when listing: %s", err)
+		}
+		if len(list) != 2 {
+			t.Fatalf("expected 2 sessions, got %+v", list)
+		}
+
+		s.Release(id1)
+		if list, _ = s.List(owner); len(list) != 1 || list[0].ID != id2 {
+			t.Fatalf("expected only %s left, got %+v", id2, list)
+		}
+
+		if err = s.ReleaseAll(owner); err != nil {
+			t.Fatalf("unexpected error when releasing: %s", err)
+		}
+		if _, _, err = s.Get(id2); err == nil {
+			t.Fatal("expected session to be released")
 		}
 	})
 
@@ -107,3 +223,22 @@ func TestStore(t *testing.T) {
 		}
 	})
 }
+
+func TestGetClient(t *testing.T) {
+	c := redis.NewClient(options())
+	defer c.Close()
+	s := &GoRedisStore{UniversalClient: c}
+	if s.GetClient() != c {
+		t.Error("expected GetClient to return single node client")
+	}
+
+	ring := redis.NewRing(&redis.RingOptions{})
+	defer ring.Close()
+	s = &GoRedisStore{UniversalClient: ring}
+	if s.GetClient() != nil {
+		t.Error("expected GetClient to return nil for ring client")
+	}
+	if s.Client() != ring {
+		t.Error("expected Client to return ring client")
+	}
+}
@@ -0,0 +1,470 @@
+// Package sqlstore implements session store logic shared by SQL based stores
+//
+// Time related columns are stored as unix timestamp (in seconds), and current
+// time is computed by database, so it is safe to share the store between
+// servers.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Ronmi/rtoolkit/session/store"
+)
+
+// Schema defines table and column names used by the store
+type Schema struct {
+	Table     string
+	ID        string
+	Seed      string
+	Data      string
+	TTL       string
+	MaxAge    string
+	Created   string
+	Expire    string
+	Owner     string
+	IP        string
+	UserAgent string
+	LastSeen  string
+	Version   string
+}
+
+// DefaultSchema is the default table and column names
+var DefaultSchema = Schema{
+	Table:     "session_storage",
+	ID:        "sid",
+	Seed:      "seed",
+	Data:      "data",
+	TTL:       "ttl",
+	MaxAge:    "max_age",
+	Created:   "created",
+	Expire:    "expire",
+	Owner:     "owner",
+	IP:        "ip",
+	UserAgent: "ua",
+	LastSeen:  "last_seen",
+	Version:   "ver",
+}
+
+// Dialect defines differences between databases
+type Dialect struct {
+	// SQL expression of current unix timestamp, in seconds
+	Now string
+	// Placeholder returns n-th (from 1) placeholder, nil means "?"
+	Placeholder func(n int) string
+	// Quote quotes table/column name, nil means double quotes
+	Quote func(name string) string
+	// InsertIgnore uses "INSERT IGNORE" instead of "ON CONFLICT DO NOTHING"
+	// when allocating new session
+	InsertIgnore bool
+	// Expire is SQL expression to compute expire time from {ttl}, {max_age},
+	// {created} and {now}. Empty means a CASE expression.
+	Expire string
+	// ChangedRows reports that RowsAffected is number of changed rows, not
+	// matched rows (like MySQL), so an update which changes nothing is
+	// checked by reading the session
+	ChangedRows bool
+}
+
+// DoubleQuote quotes name with double quotes, like "name"
+func DoubleQuote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Build replaces {name} in qstr with quoted table/column name, {now} with
+// Dialect.Now and "?" with placeholders
+func (d Dialect) Build(s Schema, qstr string) string {
+	q := d.Quote
+	if q == nil {
+		q = DoubleQuote
+	}
+	qstr = strings.NewReplacer(
+		"{table}", q(s.Table),
+		"{id}", q(s.ID),
+		"{seed}", q(s.Seed),
+		"{data}", q(s.Data),
+		"{ttl}", q(s.TTL),
+		"{max_age}", q(s.MaxAge),
+		"{created}", q(s.Created),
+		"{expire}", q(s.Expire),
+		"{owner}", q(s.Owner),
+		"{ip}", q(s.IP),
+		"{ua}", q(s.UserAgent),
+		"{last_seen}", q(s.LastSeen),
+		"{ver}", q(s.Version),
+		"{now}", d.Now,
+	).Replace(qstr)
+
+	if d.Placeholder == nil {
+		return qstr
+	}
+
+	parts := strings.Split(qstr, "?")
+	buf := &strings.Builder{}
+	buf.WriteString(parts[0])
+	for x, p := range parts[1:] {
+		buf.WriteString(d.Placeholder(x + 1))
+		buf.WriteString(p)
+	}
+	return buf.String()
+}
+
+// DollarPlaceholder generates placeholders like $1, $2 ...
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// expression to compute expire time, respects both ttl and max age
+const exprExpire = "CASE WHEN {max_age} > 0 AND {created} + {max_age} < {now} + {ttl} THEN {created} + {max_age} ELSE {now} + {ttl} END"
+
+// DefaultGCInterval is how often expired sessions are cleared
+const DefaultGCInterval = time.Minute
+
+// Store implements store.VersionedStore, store.IndexedStore and
+// store.ContextStore
+type Store struct {
+	ttl      int
+	prefix   string // prefix of error messages
+	changed  bool   // RowsAffected counts changed rows only
+	ttlArgs  int    // number of ttl placeholders in stmtTTL
+	stmtGet  *sql.Stmt
+	stmtPut  *sql.Stmt
+	stmtCAS  *sql.Stmt
+	stmtTTL  *sql.Stmt
+	stmtREF  *sql.Stmt
+	stmtBind *sql.Stmt
+	stmtList *sql.Stmt
+	stmtCLR  *sql.Stmt
+	stmtCLRA *sql.Stmt
+	stmtNEW  *sql.Stmt
+	stmtGC   *sql.Stmt
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// New creates a Store, and starts a goroutine to clear expired sessions
+// every DefaultGCInterval. It panics if failed to prepare statements.
+//
+// prefix is used in error messages, like "rtoolkit/session/store/sqlite".
+func New(db *sql.DB, schema Schema, d Dialect, prefix string) *Store {
+	ret := &Store{
+		prefix:  prefix,
+		changed: d.ChangedRows,
+		stop:    make(chan struct{}),
+	}
+	p := func(qstr string) *sql.Stmt {
+		ret, err := db.Prepare(d.Build(schema, qstr))
+		if err != nil {
+			panic(err)
+		}
+
+		return ret
+	}
+
+	expire := exprExpire
+	if d.Expire != "" {
+		expire = d.Expire
+	}
+	// stmtTTL computes expire time with new ttl
+	expireTTL := strings.Replace(expire, "{ttl}", "?", -1)
+	ret.ttlArgs = strings.Count(expire, "{ttl}")
+	insert, ignore := "INSERT INTO", " ON CONFLICT DO NOTHING"
+	if d.InsertIgnore {
+		insert, ignore = "INSERT IGNORE INTO", ""
+	}
+
+	ret.stmtGet = p(
+		"SELECT {seed},{data},{created},{ttl},{max_age},{ver} FROM {table} WHERE {id}=? AND {expire} > {now}",
+	)
+	ret.stmtPut = p(
+		"UPDATE {table} SET {seed}=?, {data}=?, {ver}={ver}+1, {last_seen}={now}, {expire}=" + expire + " WHERE {id}=? AND {expire} > {now}",
+	)
+	ret.stmtCAS = p(
+		"UPDATE {table} SET {seed}=?, {data}=?, {ver}={ver}+1, {last_seen}={now}, {expire}=" + expire + " WHERE {id}=? AND {ver}=? AND {expire} > {now}",
+	)
+	ret.stmtTTL = p(
+		"UPDATE {table} SET {ttl}=?, {last_seen}={now}, {expire}=" + expireTTL + " WHERE {id}=? AND {expire} > {now}",
+	)
+	ret.stmtREF = p(
+		"UPDATE {table} SET {last_seen}={now}, {expire}=" + expire + " WHERE {id}=? AND {expire} > {now}",
+	)
+	ret.stmtBind = p(
+		"UPDATE {table} SET {owner}=?, {ip}=?, {ua}=?, {last_seen}={now}, {expire}=" + expire + " WHERE {id}=? AND {expire} > {now}",
+	)
+	ret.stmtList = p(
+		"SELECT {id},{created},{ttl},{max_age},{ver},{last_seen},{ip},{ua} FROM {table} WHERE {owner}=? AND {expire} > {now}",
+	)
+	ret.stmtCLR = p(
+		"DELETE FROM {table} WHERE {id}=?",
+	)
+	ret.stmtCLRA = p(
+		"DELETE FROM {table} WHERE {owner}=?",
+	)
+	ret.stmtNEW = p(
+		insert + " {table} ({id},{seed},{data},{ttl},{max_age},{created},{expire},{owner},{ip},{ua},{last_seen},{ver}) VALUES (?,?,'',?,?,{now},{now}+?,'','','',{now},0)" + ignore,
+	)
+	ret.stmtGC = p(
+		"DELETE FROM {table} WHERE {expire} <= {now}",
+	)
+
+	go ret.janitor(DefaultGCInterval)
+	return ret
+}
+
+func (s *Store) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			s.GC()
+		}
+	}
+}
+
+// GC clears expired sessions
+func (s *Store) GC() error {
+	_, err := s.stmtGC.Exec()
+	return err
+}
+
+// Close stops background GC, database connection is not closed
+func (s *Store) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+func (s *Store) errNotFound(sessID string) error {
+	return errors.New(s.prefix + ": session not exists: " + sessID)
+}
+
+// SetTTL decides how long before data to be considered invalid (in seconds)
+func (s *Store) SetTTL(ttl int) {
+	s.ttl = ttl
+}
+
+func (s *Store) tryInsert(ctx context.Context, sid, seed string, ttl, maxAge int) (bool, error) {
+	exp := ttl
+	if maxAge > 0 && maxAge < exp {
+		exp = maxAge
+	}
+	res, err := s.stmtNEW.ExecContext(ctx, sid, seed, ttl, maxAge, exp)
+	if err != nil {
+		return false, err
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return cnt == 1, nil
+}
+
+// Allocate creates a new session id
+func (s *Store) Allocate(seed string) (string, error) {
+	return s.AllocateTimed(seed, s.ttl, 0)
+}
+
+// AllocateTimed is identical to Allocate, but uses specified ttl and max age
+func (s *Store) AllocateTimed(seed string, ttl, maxAge int) (string, error) {
+	return s.AllocateContext(context.Background(), seed, ttl, maxAge)
+}
+
+// AllocateContext is identical to AllocateTimed, with context
+func (s *Store) AllocateContext(ctx context.Context, seed string, ttl, maxAge int) (string, error) {
+	var err error
+	sid := store.GenerateRandomKey(32, func(id string) bool {
+		var ret bool
+		ret, err = s.tryInsert(ctx, id, seed, ttl, maxAge)
+		if err != nil {
+			return true
+		}
+
+		return ret
+	})
+
+	return sid, err
+}
+
+// exec runs an update statement, returns error if the session is not found
+func (s *Store) exec(ctx context.Context, stmt *sql.Stmt, sessID string, args ...interface{}) error {
+	res, err := stmt.ExecContext(ctx, append(args, sessID)...)
+	if err != nil {
+		return err
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return nil
+	}
+	if s.changed {
+		// nothing changed, like refreshing twice in a second
+		_, _, _, err = s.load(ctx, sessID)
+		return err
+	}
+
+	return s.errNotFound(sessID)
+}
+
+// load reads session data without refreshing ttl
+func (s *Store) load(ctx context.Context, sessID string) (seed, data string, info store.Info, err error) {
+	var created int64
+	err = s.stmtGet.QueryRowContext(ctx, sessID).Scan(
+		&seed, &data, &created, &info.TTL, &info.MaxAge, &info.Version,
+	)
+	if err == sql.ErrNoRows {
+		err = s.errNotFound(sessID)
+	}
+	if err != nil {
+		return "", "", store.Info{}, err
+	}
+
+	info.Created = time.Unix(created, 0)
+	return
+}
+
+// Get returns session data and refreshes ttl
+func (s *Store) Get(sessID string) (seed, data string, err error) {
+	seed, data, _, err = s.GetTimed(sessID)
+	return
+}
+
+// GetTimed is identical to Get, but returns lifetime information too
+func (s *Store) GetTimed(sessID string) (seed, data string, info store.Info, err error) {
+	return s.GetContext(context.Background(), sessID)
+}
+
+// GetContext is identical to GetTimed, with context
+func (s *Store) GetContext(ctx context.Context, sessID string) (seed, data string, info store.Info, err error) {
+	if err = s.exec(ctx, s.stmtREF, sessID); err != nil {
+		return
+	}
+
+	return s.load(ctx, sessID)
+}
+
+// Set saves session data and refreshes ttl
+func (s *Store) Set(sessID string, seed, data string) error {
+	return s.SetContext(context.Background(), sessID, seed, data)
+}
+
+// SetContext is identical to Set, with context
+func (s *Store) SetContext(ctx context.Context, sessID string, seed, data string) error {
+	return s.exec(ctx, s.stmtPut, sessID, seed, data)
+}
+
+// SetVersion is identical to Set, but saves data only if current version is ver
+func (s *Store) SetVersion(sessID string, seed, data string, ver int64) error {
+	return s.SetVersionContext(context.Background(), sessID, seed, data, ver)
+}
+
+// SetVersionContext is identical to SetVersion, with context
+func (s *Store) SetVersionContext(ctx context.Context, sessID string, seed, data string, ver int64) error {
+	res, err := s.stmtCAS.ExecContext(ctx, seed, data, sessID, ver)
+	if err != nil {
+		return err
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return nil
+	}
+
+	if _, _, _, err = s.load(ctx, sessID); err != nil {
+		return err
+	}
+	return store.ErrConflict
+}
+
+// SetSessionTTL changes idle timeout of a session and refreshes it
+func (s *Store) SetSessionTTL(sessID string, ttl int) error {
+	return s.SetSessionTTLContext(context.Background(), sessID, ttl)
+}
+
+// SetSessionTTLContext is identical to SetSessionTTL, with context
+func (s *Store) SetSessionTTLContext(ctx context.Context, sessID string, ttl int) error {
+	args := make([]interface{}, s.ttlArgs+1)
+	for x := range args {
+		args[x] = ttl
+	}
+	return s.exec(ctx, s.stmtTTL, sessID, args...)
+}
+
+// Release clears a session, never fail
+func (s *Store) Release(sessID string) {
+	_ = s.ReleaseContext(context.Background(), sessID)
+}
+
+// ReleaseContext is identical to Release, but returns error
+func (s *Store) ReleaseContext(ctx context.Context, sessID string) error {
+	_, err := s.stmtCLR.ExecContext(ctx, sessID)
+	return err
+}
+
+// Bind associates a session with owner, and records client information
+func (s *Store) Bind(sessID, owner, ip, userAgent string) error {
+	return s.BindContext(context.Background(), sessID, owner, ip, userAgent)
+}
+
+// BindContext is identical to Bind, with context
+func (s *Store) BindContext(ctx context.Context, sessID, owner, ip, userAgent string) error {
+	return s.exec(ctx, s.stmtBind, sessID, owner, ip, userAgent)
+}
+
+// List returns active sessions of the owner
+func (s *Store) List(owner string) ([]store.Meta, error) {
+	return s.ListContext(context.Background(), owner)
+}
+
+// ListContext is identical to List, with context
+func (s *Store) ListContext(ctx context.Context, owner string) ([]store.Meta, error) {
+	rows, err := s.stmtList.QueryContext(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []store.Meta{}
+	for rows.Next() {
+		var created, seen int64
+		m := store.Meta{Owner: owner}
+		err = rows.Scan(
+			&m.ID, &created, &m.TTL, &m.MaxAge, &m.Version, &seen, &m.IP, &m.UserAgent,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Created = time.Unix(created, 0)
+		m.LastSeen = time.Unix(seen, 0)
+		ret = append(ret, m)
+	}
+
+	return ret, rows.Err()
+}
+
+// ReleaseAll clears all sessions of the owner
+func (s *Store) ReleaseAll(owner string) error {
+	return s.ReleaseAllContext(context.Background(), owner)
+}
+
+// ReleaseAllContext is identical to ReleaseAll, with context
+func (s *Store) ReleaseAllContext(ctx context.Context, owner string) error {
+	_, err := s.stmtCLRA.ExecContext(ctx, owner)
+	return err
+}
@@ -0,0 +1,624 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WritePolicy decides when session data is written into backing store of a
+// LayeredStore
+type WritePolicy int
+
+const (
+	// WriteThrough writes data into backing store before updating cache
+	WriteThrough WritePolicy = iota
+	// WriteBehind updates cache and writes data into backing store in
+	// background every FlushInterval. Data might be lost if the process
+	// crashed, and other replicas see stale data before flushing.
+	WriteBehind
+)
+
+const (
+	// DefaultCacheTTL is default value of LayeredStore.CacheTTL
+	DefaultCacheTTL = time.Minute
+	// DefaultFlushInterval is default value of LayeredStore.FlushInterval
+	DefaultFlushInterval = time.Second
+)
+
+type cacheEntry struct {
+	seed   string
+	data   string
+	info   Info
+	synced time.Time // last time the session is read from or written to backing store
+}
+
+// LayeredStore caches sessions of a backing store in memory, reduces loading
+// of the backing store. Cache misses are read through the backing store.
+//
+// Cached copy of a session is used at most CacheTTL (and half of its own
+// ttl), then read from the backing store again. After half of that time, a
+// cache hit reads the session from backing store in background, which also
+// refreshes ttl of the session in the backing store, so active sessions do
+// not expire there. Cached copies never outlive the session in the backing
+// store, but might be stale if the session has been modified by other
+// replicas. Use OnInvalidate and Evict to propagate changes between
+// replicas, like
+//
+//     s := store.Layered(mysqlStore, 10000)
+//     s.OnInvalidate = func(id string) {
+//         redisClient.Publish("session:invalidate", id)
+//     }
+//     go func() {
+//         for msg := range redisClient.Subscribe("session:invalidate").Channel() {
+//             s.Evict(msg.Payload)
+//         }
+//     }()
+//
+// If the backing store does not implement TimedStore, you have to call SetTTL
+// of LayeredStore, or nothing is cached.
+//
+// Policy and other fields MUST NOT be modified after first use. With
+// WriteBehind policy, versions of cached sessions are not updated until
+// flushed, so use WriteThrough if you need session.ConflictFail.
+//
+// LayeredStore implements VersionedStore, IndexedStore and ContextStore.
+// Methods return ErrNotSupported if the backing store does not support them.
+type LayeredStore struct {
+	// Policy decides when data is written into backing store, default to
+	// WriteThrough
+	Policy WritePolicy
+	// CacheTTL is how long a cached copy can be used without reading the
+	// backing store, default to DefaultCacheTTL
+	CacheTTL time.Duration
+	// FlushInterval is how often pending data is written into backing store
+	// with WriteBehind policy, default to DefaultFlushInterval
+	FlushInterval time.Duration
+	// OnInvalidate is called after a session is modified or released by
+	// this store, so you can evict cached copies in other replicas
+	OnInvalidate func(sessID string)
+	// OnError is called if failed to write pending data with WriteBehind
+	// policy
+	OnError func(sessID string, err error)
+
+	store      Store
+	backing    ContextStore
+	lock       sync.Mutex
+	ttl        int // protected by lock
+	cache      *lru
+	pending    map[string]*cacheEntry // data not written to backing store yet
+	refreshing map[string]bool        // sessions being read in background
+	refreshes  sync.WaitGroup
+	once       sync.Once
+	closeOnce  sync.Once
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// Layered creates a LayeredStore caches at most size sessions of backing
+// store, size <= 0 means unlimited.
+func Layered(backing Store, size int) *LayeredStore {
+	return &LayeredStore{
+		store:      backing,
+		backing:    WithContext(backing),
+		cache:      newLRU(size),
+		pending:    map[string]*cacheEntry{},
+		refreshing: map[string]bool{},
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// start starts background flushing goroutine
+func (s *LayeredStore) start() {
+	s.once.Do(func() {
+		if s.Policy != WriteBehind {
+			close(s.done)
+			return
+		}
+
+		go s.flusher()
+	})
+}
+
+func (s *LayeredStore) flusher() {
+	defer close(s.done)
+	d := s.FlushInterval
+	if d <= 0 {
+		d = DefaultFlushInterval
+	}
+	t := time.NewTicker(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			s.Flush()
+			return
+		case <-t.C:
+			s.Flush()
+		}
+	}
+}
+
+// Close writes pending data into backing store and stops background
+// goroutines. Backing store is not closed.
+func (s *LayeredStore) Close() error {
+	s.start()
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+	s.refreshes.Wait()
+	return nil
+}
+
+// Flush writes pending data into backing store, returns first error.
+func (s *LayeredStore) Flush() error {
+	s.lock.Lock()
+	pending := make(map[string]*cacheEntry, len(s.pending))
+	for id, e := range s.pending {
+		pending[id] = e
+	}
+	s.lock.Unlock()
+
+	var ret error
+	for id, e := range pending {
+		if err := s.flush(context.Background(), id, e); err != nil && ret == nil {
+			ret = err
+		}
+	}
+
+	return ret
+}
+
+// flush writes pending data e, it is kept in pending list until written so
+// readers never see stale data in backing store
+func (s *LayeredStore) flush(ctx context.Context, id string, e *cacheEntry) error {
+	return s.written(id, e, s.backing.SetContext(ctx, id, e.seed, e.data))
+}
+
+// written updates cache after pending data e is written with err
+func (s *LayeredStore) written(id string, e *cacheEntry, err error) error {
+	s.lock.Lock()
+	if err == nil {
+		s.rebase(id, e)
+	} else {
+		if s.pending[id] == e {
+			delete(s.pending, id)
+		}
+		s.cache.remove(id)
+	}
+	s.lock.Unlock()
+
+	if err != nil && s.OnError != nil {
+		s.OnError(id, err)
+	}
+	return err
+}
+
+// rebase removes e from pending list, and updates version of cached copy or
+// newer pending data based on e, since writing e increases the version in
+// backing store. Caller must hold the lock.
+func (s *LayeredStore) rebase(id string, e *cacheEntry) {
+	cur, pending := s.pending[id]
+	if cur == e {
+		delete(s.pending, id)
+		pending = false
+	}
+	v, cached := s.cache.peek(id)
+	if !pending {
+		if !cached {
+			return
+		}
+		cur = v.(*cacheEntry)
+	}
+	if cur.info.Version != e.info.Version {
+		return
+	}
+
+	n := *cur
+	n.info.Version++
+	n.synced = time.Now()
+	if pending {
+		s.pending[id] = &n
+	}
+	if cached {
+		s.cache.add(id, &n)
+	}
+}
+
+// flushOne writes pending data of a session
+func (s *LayeredStore) flushOne(ctx context.Context, sessID string) error {
+	s.lock.Lock()
+	e, ok := s.pending[sessID]
+	s.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.flush(ctx, sessID, e)
+}
+
+// Evict removes cached copy of a session. Pending data of the session is
+// written into backing store first, so it is not lost.
+//
+// If the backing store implements VersionedStore, pending data is written
+// only if the session is not modified or released by others since cached,
+// or it is dropped and passed to OnError.
+func (s *LayeredStore) Evict(sessID string) {
+	s.lock.Lock()
+	s.cache.remove(sessID)
+	e, ok := s.pending[sessID]
+	s.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	err := s.backing.SetVersionContext(ctx, sessID, e.seed, e.data, e.info.Version)
+	if err == ErrNotSupported {
+		err = s.backing.SetContext(ctx, sessID, e.seed, e.data)
+	}
+	s.written(sessID, e, err)
+}
+
+// drop removes cached copy and pending data of a session, it does not touch
+// backing store
+func (s *LayeredStore) drop(sessID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.cache.remove(sessID)
+	delete(s.pending, sessID)
+}
+
+func (s *LayeredStore) invalidate(sessID string) {
+	if s.OnInvalidate != nil {
+		s.OnInvalidate(sessID)
+	}
+}
+
+// window returns how long cached copy can be used since synced
+func (s *LayeredStore) window(e *cacheEntry) time.Duration {
+	d := s.CacheTTL
+	if d <= 0 {
+		d = DefaultCacheTTL
+	}
+	if half := time.Duration(e.info.TTL) * time.Second / 2; half < d {
+		d = half
+	}
+
+	return d
+}
+
+// fresh reports whether cached copy can be used at t
+func (s *LayeredStore) fresh(e *cacheEntry, t time.Time) bool {
+	if !t.Before(e.synced.Add(s.window(e))) {
+		return false
+	}
+	if e.info.MaxAge > 0 && !t.Before(e.info.Created.Add(time.Duration(e.info.MaxAge)*time.Second)) {
+		return false
+	}
+	return true
+}
+
+// load returns cached copy of a session
+func (s *LayeredStore) load(sessID string) (*cacheEntry, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if e, ok := s.pending[sessID]; ok {
+		s.cache.get(sessID)
+		return e, true
+	}
+
+	v, ok := s.cache.get(sessID)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(*cacheEntry)
+	now := time.Now()
+	if !s.fresh(e, now) {
+		s.cache.remove(sessID)
+		return nil, false
+	}
+	if !s.refreshing[sessID] && !now.Before(e.synced.Add(s.window(e)/2)) {
+		s.refreshing[sessID] = true
+		s.refreshes.Add(1)
+		go s.refresh(sessID, e)
+	}
+
+	return e, true
+}
+
+// refresh reads cached session e from backing store, which also refreshes its
+// ttl in backing store
+func (s *LayeredStore) refresh(sessID string, e *cacheEntry) {
+	defer s.refreshes.Done()
+	seed, data, info, err := s.backing.GetContext(context.Background(), sessID)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.refreshing, sessID)
+	if v, ok := s.cache.peek(sessID); !ok || v.(*cacheEntry) != e {
+		// modified or evicted meanwhile
+		return
+	}
+	if err != nil {
+		s.cache.remove(sessID)
+		return
+	}
+
+	if info.TTL == 0 {
+		info.TTL = s.ttl
+	}
+	s.cache.add(sessID, &cacheEntry{
+		seed:   seed,
+		data:   data,
+		info:   info,
+		synced: time.Now(),
+	})
+}
+
+// save updates cache, and marks it as pending if dirty
+func (s *LayeredStore) save(sessID string, e *cacheEntry, dirty bool) {
+	s.lock.Lock()
+	if dirty {
+		s.pending[sessID] = e
+	}
+	evicted := s.cache.add(sessID, e)
+	if evicted != nil {
+		if p, ok := s.pending[evicted.key]; ok {
+			s.lock.Unlock()
+			s.flush(context.Background(), evicted.key, p)
+			return
+		}
+	}
+	s.lock.Unlock()
+}
+
+// SetTTL sets ttl of backing store
+func (s *LayeredStore) SetTTL(ttl int) {
+	s.lock.Lock()
+	s.ttl = ttl
+	s.lock.Unlock()
+	s.backing.SetTTL(ttl)
+}
+
+// Allocate allocates a session in backing store, it is cached when first read
+func (s *LayeredStore) Allocate(seed string) (string, error) {
+	return s.store.Allocate(seed)
+}
+
+// AllocateTimed allocates a session in backing store
+func (s *LayeredStore) AllocateTimed(seed string, ttl, maxAge int) (string, error) {
+	return s.AllocateContext(context.Background(), seed, ttl, maxAge)
+}
+
+// AllocateContext allocates a session in backing store
+func (s *LayeredStore) AllocateContext(ctx context.Context, seed string, ttl, maxAge int) (string, error) {
+	id, err := s.backing.AllocateContext(ctx, seed, ttl, maxAge)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	s.save(id, &cacheEntry{
+		seed:   seed,
+		info:   Info{Created: now, TTL: ttl, MaxAge: maxAge},
+		synced: now,
+	}, false)
+	return id, nil
+}
+
+// Get returns session data, from cache if possible
+func (s *LayeredStore) Get(sessID string) (seed, data string, err error) {
+	seed, data, _, err = s.GetContext(context.Background(), sessID)
+	return
+}
+
+// GetTimed returns session data, from cache if possible
+func (s *LayeredStore) GetTimed(sessID string) (seed, data string, info Info, err error) {
+	return s.GetContext(context.Background(), sessID)
+}
+
+// GetContext returns session data, from cache if possible
+func (s *LayeredStore) GetContext(ctx context.Context, sessID string) (seed, data string, info Info, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	if e, ok := s.load(sessID); ok {
+		return e.seed, e.data, e.info, nil
+	}
+
+	if seed, data, info, err = s.backing.GetContext(ctx, sessID); err != nil {
+		return
+	}
+
+	if info.TTL == 0 {
+		// backing store does not record lifetime
+		s.lock.Lock()
+		info.TTL = s.ttl
+		s.lock.Unlock()
+	}
+	s.save(sessID, &cacheEntry{
+		seed:   seed,
+		data:   data,
+		info:   info,
+		synced: time.Now(),
+	}, false)
+	return
+}
+
+// update computes new cache entry from pending data or cached copy, or
+// returns nil if not cached
+func (s *LayeredStore) update(sessID string, f func(e *cacheEntry)) *cacheEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	v, ok := s.pending[sessID]
+	if !ok {
+		x, found := s.cache.peek(sessID)
+		if !found {
+			return nil
+		}
+		v = x.(*cacheEntry)
+	}
+
+	e := *v
+	f(&e)
+	return &e
+}
+
+// Set saves session data according to Policy
+func (s *LayeredStore) Set(sessID, seed, data string) error {
+	return s.SetContext(context.Background(), sessID, seed, data)
+}
+
+// SetContext saves session data according to Policy
+func (s *LayeredStore) SetContext(ctx context.Context, sessID, seed, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.start()
+	if s.Policy == WriteBehind {
+		e := s.update(sessID, func(e *cacheEntry) {
+			e.seed = seed
+			e.data = data
+		})
+		if e != nil {
+			s.save(sessID, e, true)
+			s.invalidate(sessID)
+			return nil
+		}
+		// not cached, write through
+	}
+
+	if err := s.backing.SetContext(ctx, sessID, seed, data); err != nil {
+		s.drop(sessID)
+		return err
+	}
+
+	if e := s.update(sessID, func(e *cacheEntry) {
+		e.seed = seed
+		e.data = data
+		e.info.Version++
+		e.synced = time.Now()
+	}); e != nil {
+		s.save(sessID, e, false)
+	}
+	s.invalidate(sessID)
+	return nil
+}
+
+// SetVersion saves session data into backing store if version matches
+func (s *LayeredStore) SetVersion(sessID, seed, data string, ver int64) error {
+	return s.SetVersionContext(context.Background(), sessID, seed, data, ver)
+}
+
+// SetVersionContext saves session data into backing store if version
+// matches, pending data of the session is written first.
+func (s *LayeredStore) SetVersionContext(ctx context.Context, sessID, seed, data string, ver int64) error {
+	if err := s.flushOne(ctx, sessID); err != nil {
+		return err
+	}
+
+	if err := s.backing.SetVersionContext(ctx, sessID, seed, data, ver); err != nil {
+		s.drop(sessID)
+		return err
+	}
+
+	if e := s.update(sessID, func(e *cacheEntry) {
+		e.seed = seed
+		e.data = data
+		e.info.Version = ver + 1
+		e.synced = time.Now()
+	}); e != nil {
+		s.save(sessID, e, false)
+	}
+	s.invalidate(sessID)
+	return nil
+}
+
+// SetSessionTTL changes idle timeout of a session in backing store
+func (s *LayeredStore) SetSessionTTL(sessID string, ttl int) error {
+	return s.SetSessionTTLContext(context.Background(), sessID, ttl)
+}
+
+// SetSessionTTLContext changes idle timeout of a session in backing store
+func (s *LayeredStore) SetSessionTTLContext(ctx context.Context, sessID string, ttl int) error {
+	if err := s.backing.SetSessionTTLContext(ctx, sessID, ttl); err != nil {
+		return err
+	}
+
+	if e := s.update(sessID, func(e *cacheEntry) {
+		e.info.TTL = ttl
+		e.synced = time.Now()
+	}); e != nil {
+		s.save(sessID, e, false)
+	}
+	s.invalidate(sessID)
+	return nil
+}
+
+// Release clears a session from cache and backing store
+func (s *LayeredStore) Release(sessID string) {
+	_ = s.ReleaseContext(context.Background(), sessID)
+}
+
+// ReleaseContext clears a session from cache and backing store
+func (s *LayeredStore) ReleaseContext(ctx context.Context, sessID string) error {
+	s.drop(sessID)
+	err := s.backing.ReleaseContext(ctx, sessID)
+	s.invalidate(sessID)
+	return err
+}
+
+// Bind associates a session with owner in backing store
+func (s *LayeredStore) Bind(sessID, owner, ip, userAgent string) error {
+	return s.BindContext(context.Background(), sessID, owner, ip, userAgent)
+}
+
+// BindContext associates a session with owner in backing store
+func (s *LayeredStore) BindContext(ctx context.Context, sessID, owner, ip, userAgent string) error {
+	return s.backing.BindContext(ctx, sessID, owner, ip, userAgent)
+}
+
+// List returns active sessions of the owner in backing store
+func (s *LayeredStore) List(owner string) ([]Meta, error) {
+	return s.ListContext(context.Background(), owner)
+}
+
+// ListContext returns active sessions of the owner in backing store
+func (s *LayeredStore) ListContext(ctx context.Context, owner string) ([]Meta, error) {
+	return s.backing.ListContext(ctx, owner)
+}
+
+// ReleaseAll clears all sessions of the owner from cache and backing store
+func (s *LayeredStore) ReleaseAll(owner string) error {
+	return s.ReleaseAllContext(context.Background(), owner)
+}
+
+// ReleaseAllContext clears all sessions of the owner from cache and backing
+// store
+func (s *LayeredStore) ReleaseAllContext(ctx context.Context, owner string) error {
+	list, err := s.backing.ListContext(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		s.drop(m.ID)
+	}
+	if err = s.backing.ReleaseAllContext(ctx, owner); err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		s.invalidate(m.ID)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLayeredStore(t *testing.T) {
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+
+	t.Run("read through", func(t *testing.T) {
+		backing := InMemory(10)
+		s := Layered(backing, 10)
+		id, err := s.AllocateTimed(seed, 10, 0)
+		if err != nil {
+			t.Fatalf("cannot allocate: %s", err)
+		}
+		if err = s.Set(id, seed, "a"); err != nil {
+			t.Fatalf("cannot set: %s", err)
+		}
+		if _, data, _ := backing.Get(id); data != "a" {
+			t.Fatalf("expected data to be written through, got %s", data)
+		}
+
+		backing.Set(id, seed, "b")
+		if _, data, _ := s.Get(id); data != "a" {
+			t.Errorf("expected cached data a, got %s", data)
+		}
+
+		s.Evict(id)
+		if _, data, _ := s.Get(id); data != "b" {
+			t.Errorf("expected data b after evicted, got %s", data)
+		}
+	})
+
+	t.Run("cache ttl", func(t *testing.T) {
+		backing := InMemory(10)
+		s := Layered(backing, 10)
+		s.CacheTTL = 100 * time.Millisecond
+		id, _ := s.AllocateTimed(seed, 10, 0)
+		s.Get(id)
+
+		backing.Set(id, seed, "b")
+		time.Sleep(150 * time.Millisecond)
+		if _, data, _ := s.Get(id); data != "b" {
+			t.Errorf("expected data b after cache ttl, got %s", data)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		s := Layered(InMemory(10), 2)
+		for x := 0; x < 3; x++ {
+			s.AllocateTimed(seed, 10, 0)
+		}
+		if l := s.cache.len(); l != 2 {
+			t.Errorf("expected 2 cached sessions, got %d", l)
+		}
+	})
+
+	t.Run("write behind", func(t *testing.T) {
+		backing := InMemory(10)
+		s := Layered(backing, 1)
+		s.Policy = WriteBehind
+		s.FlushInterval = time.Hour
+		defer s.Close()
+
+		a, _ := s.AllocateTimed(seed, 10, 0)
+		if err := s.Set(a, seed, "a"); err != nil {
+			t.Fatalf("cannot set: %s", err)
+		}
+		if _, data, _ := backing.Get(a); data != "" {
+			t.Fatalf("expected data not written yet, got %s", data)
+		}
+		if _, data, _ := s.Get(a); data != "a" {
+			t.Fatalf("expected pending data a, got %s", data)
+		}
+
+		// evicting pending data writes it
+		b, _ := s.AllocateTimed(seed, 10, 0)
+		if _, data, _ := backing.Get(a); data != "a" {
+			t.Fatalf("expected evicted data to be written, got %s", data)
+		}
+
+		s.Get(b)
+		s.Set(b, seed, "b")
+		if err := s.Flush(); err != nil {
+			t.Fatalf("cannot flush: %s", err)
+		}
+		if _, data, _ := backing.Get(b); data != "b" {
+			t.Fatalf("expected data to be flushed, got %s", data)
+		}
+	})
+
+	t.Run("evict pending", func(t *testing.T) {
+		backing := InMemory(10)
+		s := Layered(backing, 10)
+		s.Policy = WriteBehind
+		s.FlushInterval = time.Hour
+		defer s.Close()
+
+		id, _ := s.AllocateTimed(seed, 10, 0)
+		s.Set(id, seed, "a")
+		s.Evict(id)
+		if _, data, _ := backing.Get(id); data != "a" {
+			t.Fatalf("expected pending data to be written when evicted, got %s", data)
+		}
+		if _, data, _ := s.Get(id); data != "a" {
+			t.Errorf("expected data a after evicted, got %s", data)
+		}
+	})
+
+	t.Run("evict modified by others", func(t *testing.T) {
+		var errs []error
+		backing := InMemory(10)
+		s := Layered(backing, 10)
+		s.Policy = WriteBehind
+		s.FlushInterval = time.Hour
+		s.OnError = func(id string, err error) { errs = append(errs, err) }
+		defer s.Close()
+
+		id, _ := s.AllocateTimed(seed, 10, 0)
+		s.Set(id, seed, "a")
+		backing.Set(id, seed, "b")
+		s.Evict(id)
+		if _, data, _ := backing.Get(id); data != "b" {
+			t.Fatalf("expected data of others to be kept, got %s", data)
+		}
+		if len(errs) != 1 || errs[0] != ErrConflict {
+			t.Errorf("expected conflict to be reported, got %v", errs)
+		}
+
+		s.Set(id, seed, "c")
+		backing.Release(id)
+		s.Evict(id)
+		if _, _, err := backing.Get(id); err == nil {
+			t.Error("expected released session not to be written")
+		}
+	})
+
+	t.Run("evict after flush", func(t *testing.T) {
+		backing := InMemory(10)
+		s := Layered(backing, 10)
+		s.Policy = WriteBehind
+		s.FlushInterval = time.Hour
+		defer s.Close()
+
+		id, _ := s.AllocateTimed(seed, 10, 0)
+		s.Set(id, seed, "a")
+		s.Flush()
+		s.Set(id, seed, "b")
+		s.Evict(id)
+		if _, data, _ := backing.Get(id); data != "b" {
+			t.Fatalf("expected pending data to be written, got %s", data)
+		}
+	})
+
+	t.Run("refresh backing ttl", func(t *testing.T) {
+		backing := newMemory(2, MemoryOptions{})
+		s := Layered(backing, 10)
+		id, _ := s.AllocateTimed(seed, 2, 0)
+		lastUsed := func() time.Duration {
+			sh := backing.shard(id)
+			sh.Lock()
+			defer sh.Unlock()
+			v, _ := sh.data.peek(id)
+			return time.Duration(time.Now().UnixNano() - v.(*memoryElement).lastUsed)
+		}
+
+		// cache hit after half of cache window refreshes backing store
+		time.Sleep(600 * time.Millisecond)
+		s.Get(id)
+		s.Close()
+		if d := lastUsed(); d > 100*time.Millisecond {
+			t.Errorf("expected session in backing store to be refreshed, last used %s ago", d)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		s := Layered(InMemory(10), 10)
+		s.Policy = WriteBehind
+		done := make(chan struct{})
+		for x := 0; x < 2; x++ {
+			go func() {
+				s.Close()
+				done <- struct{}{}
+			}()
+		}
+		<-done
+		<-done
+		s.Close()
+	})
+
+	t.Run("set ttl", func(t *testing.T) {
+		s := Layered(InMemory(10), 10)
+		id, _ := s.Allocate(seed)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for x := 0; x < 100; x++ {
+				s.Evict(id)
+				s.Get(id)
+			}
+		}()
+		for x := 0; x < 100; x++ {
+			s.SetTTL(10 + x)
+		}
+		<-done
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		var ids []string
+		s := Layered(InMemory(10), 10)
+		s.OnInvalidate = func(id string) { ids = append(ids, id) }
+
+		id, _ := s.AllocateTimed(seed, 10, 0)
+		s.Set(id, seed, "a")
+		s.Release(id)
+		if len(ids) != 2 || ids[0] != id || ids[1] != id {
+			t.Errorf("unexpected invalidated sessions: %v", ids)
+		}
+		if _, _, err := s.Get(id); err == nil {
+			t.Error("expected error getting released session")
+		}
+	})
+
+	t.Run("versioned", func(t *testing.T) {
+		s := Layered(InMemory(10), 10)
+		id, _ := s.AllocateTimed(seed, 10, 0)
+
+		_, _, info, _ := s.GetTimed(id)
+		if err := s.SetVersion(id, seed, "a", info.Version); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := s.SetVersion(id, seed, "b", info.Version); err != ErrConflict {
+			t.Fatalf("expected conflict, got %v", err)
+		}
+		if _, data, info2, _ := s.GetTimed(id); data != "a" || info2.Version != info.Version+1 {
+			t.Errorf("expected data a at version %d, got %s at %d", info.Version+1, data, info2.Version)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package store
+
+import "container/list"
+
+// lru is a size-bounded map which evicts least recently used items, it is not
+// thread-safe
+type lru struct {
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	value interface{}
+}
+
+// newLRU creates a lru holds at most size items, size <= 0 means unlimited
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// get returns the value and marks it as recently used
+func (c *lru) get(key string) (interface{}, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruItem).value, true
+}
+
+// peek is identical to get, but does not mark it as recently used
+func (c *lru) peek(key string) (interface{}, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	return e.Value.(*lruItem).value, true
+}
+
+// add adds or replaces the value, returns evicted item if any
+func (c *lru) add(key string, value interface{}) (evicted *lruItem) {
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lruItem).value = value
+		return nil
+	}
+
+	c.items[key] = c.ll.PushFront(&lruItem{key: key, value: value})
+	if c.size <= 0 || c.ll.Len() <= c.size {
+		return nil
+	}
+
+	e := c.ll.Back()
+	c.ll.Remove(e)
+	evicted = e.Value.(*lruItem)
+	delete(c.items, evicted.key)
+	return evicted
+}
+
+// remove deletes the value, returns false if not found
+func (c *lru) remove(key string) (interface{}, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.Remove(e)
+	delete(c.items, key)
+	return e.Value.(*lruItem).value, true
+}
+
+// oldest returns least recently used item, or nil if empty
+func (c *lru) oldest() *lruItem {
+	e := c.ll.Back()
+	if e == nil {
+		return nil
+	}
+
+	return e.Value.(*lruItem)
+}
+
+// each iterates all items, from most recently used one
+func (c *lru) each(f func(key string, value interface{})) {
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next() // f might remove e
+		item := e.Value.(*lruItem)
+		f(item.key, item.value)
+		e = next
+	}
+}
+
+func (c *lru) len() int {
+	return c.ll.Len()
+}
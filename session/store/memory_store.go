@@ -2,33 +2,76 @@ package store
 
 import (
 	"errors"
+	"hash/fnv"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrStoreFull is returned by Allocate if memory store has reached its
+// capacity and eviction is disabled
+var ErrStoreFull = errors.New("rtoolkit/session/store: store is full")
+
+const (
+	// DefaultShards is default number of shards of memory store
+	DefaultShards = 16
+	// DefaultGCInterval is how often memory store clears expired sessions by
+	// default
+	DefaultGCInterval = time.Minute
+)
+
+// memoryElement is protected by the lock of the shard holding it
 type memoryElement struct {
-	*sync.Mutex // protects only data, lastUsed is not protected
-	data        string
-	seed        string
-	lastUsed    int64
+	data      string
+	seed      string
+	lastUsed  int64
+	created   int64
+	ttl       int64 // in nanoseconds
+	maxAge    int64 // in nanoseconds, 0 means no limit
+	owner     string
+	ip        string
+	userAgent string
+	ver       int64
 }
 
-func newMemEle(seed string) *memoryElement {
+func newMemEle(seed string, ttl, maxAge int64) *memoryElement {
+	now := time.Now().UnixNano()
 	return &memoryElement{
-		&sync.Mutex{},
-		"",
-		seed,
-		time.Now().UnixNano(),
+		seed:     seed,
+		lastUsed: now,
+		created:  now,
+		ttl:      ttl,
+		maxAge:   maxAge,
 	}
 }
 
-func (e *memoryElement) isValid(ttl int64) bool {
-	return time.Now().UnixNano() <= ttl+e.lastUsed
+func (e *memoryElement) isValid() bool {
+	now := time.Now().UnixNano()
+	if e.maxAge > 0 && now > e.created+e.maxAge {
+		return false
+	}
+	return now <= e.ttl+e.lastUsed
 }
 
-func (e *memoryElement) invalid(ttl int64) {
-	// sould be now - ttl - 1, but set zero is faster
-	e.lastUsed = 0
+func (e *memoryElement) info() Info {
+	return Info{
+		Created: time.Unix(0, e.created),
+		TTL:     int(e.ttl / int64(time.Second)),
+		MaxAge:  int(e.maxAge / int64(time.Second)),
+		Version: e.ver,
+	}
+}
+
+func (e *memoryElement) meta(id string) Meta {
+	return Meta{
+		Info:      e.info(),
+		ID:        id,
+		Owner:     e.owner,
+		LastSeen:  time.Unix(0, e.lastUsed),
+		IP:        e.ip,
+		UserAgent: e.userAgent,
+	}
 }
 
 func (e *memoryElement) get() (seed, data string) {
@@ -40,143 +83,405 @@ func (e *memoryElement) set(seed, data string) {
 	e.lastUsed = time.Now().UnixNano()
 	e.data = data
 	e.seed = seed
+	e.ver++
 }
 
-type memoryStore struct {
-	data   map[string]*memoryElement
-	ttl    int64
-	lock   *sync.Mutex // for allocate/release/gc
-	gcing  bool
-	lastgc int64
+// memoryShard holds part of sessions, ordered by last access time
+type memoryShard struct {
+	sync.Mutex
+	data *lru
 }
 
-func (s *memoryStore) SetTTL(ttl int) {
-	s.ttl = int64(ttl) * int64(time.Second)
+// MemoryOptions configures memory store created by NewMemory
+type MemoryOptions struct {
+	// Capacity is max number of sessions, 0 means unlimited. Least recently
+	// used session is evicted when allocating in a full store. Each shard
+	// keeps its own LRU order and oldest sessions of shards are compared, so
+	// it is approximate when sessions are accessed concurrently.
+	Capacity int
+	// NoEvict makes Allocate return ErrStoreFull if store is full, instead
+	// of evicting least recently used session. Expired sessions are cleared
+	// before that.
+	NoEvict bool
+	// Shards is number of shards, more shards means less lock contention.
+	// Default to DefaultShards.
+	Shards int
+	// GCInterval is how often expired sessions are cleared, default to
+	// DefaultGCInterval
+	GCInterval time.Duration
 }
 
-func (s *memoryStore) Allocate(seed string) (id string, err error) {
-	go s.gc() // run gc
-
-	id = GenerateRandomKey(32, func(id string) bool {
-		s.lock.Lock()
-		defer s.lock.Unlock()
-
-		_, ok := s.data[id]
-		if !ok {
-			s.data[id] = newMemEle(seed)
-		}
+// MemoryStore is a sharded in-memory store, implements VersionedStore and
+// IndexedStore
+//
+// Stores created by NewMemory clear expired sessions in a background
+// goroutine every GCInterval. You MUST call Close() when the store is no
+// longer used, or the goroutine and the store are never freed.
+type MemoryStore struct {
+	shards   []*memoryShard
+	capacity int64 // 0 means unlimited
+	count    int64 // number of sessions and reserved slots, accessed atomically
+	noEvict  bool
+	owners   map[string]map[string]bool // owner => session ids
+	olock    sync.Mutex                 // protects owners
+	ttl      int64                      // accessed atomically
+	interval int64                      // gc interval, in nanoseconds
+	lastgc   int64                      // unix timestamp in nanoseconds, accessed atomically
+	stop     chan struct{}              // nil if there's no background goroutine
+	once     sync.Once
+}
 
-		return !ok
-	})
+func newMemory(ttl int, opts MemoryOptions) *MemoryStore {
+	n := opts.Shards
+	if n <= 0 {
+		n = DefaultShards
+	}
+	interval := opts.GCInterval
+	if interval <= 0 {
+		interval = DefaultGCInterval
+	}
 
-	return
+	s := &MemoryStore{
+		shards:   make([]*memoryShard, n),
+		capacity: int64(opts.Capacity),
+		noEvict:  opts.NoEvict,
+		owners:   make(map[string]map[string]bool),
+		interval: int64(interval),
+		lastgc:   time.Now().UnixNano(),
+	}
+	for x := range s.shards {
+		s.shards[x] = &memoryShard{data: newLRU(0)}
+	}
+	s.SetTTL(ttl)
+	return s
 }
 
-func (s *memoryStore) Release(id string) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+// NewMemory creates a memory store with options, and starts a goroutine to
+// clear expired sessions. Call Close() to stop it.
+func NewMemory(ttl int, opts MemoryOptions) *MemoryStore {
+	s := newMemory(ttl, opts)
+	s.stop = make(chan struct{})
+	go s.janitor(time.Duration(s.interval))
+	return s
+}
 
-	s.doRelease(id)
+// InMemory creates a memory store without capacity limit, which also
+// implements VersionedStore and IndexedStore. See NewMemory for more options.
+//
+// No background goroutine is started, expired sessions are cleared when
+// allocating new session, at most once every DefaultGCInterval. So it is safe
+// to drop the store without closing it.
+func InMemory(ttl int) Store {
+	return newMemory(ttl, MemoryOptions{})
 }
 
-func (s *memoryStore) doRelease(id string) {
-	if data, ok := s.data[id]; ok {
-		data.Lock()
-		defer data.Unlock()
-		data.invalid(s.ttl)
+func (s *MemoryStore) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
 
-		delete(s.data, id)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			s.gc()
+		}
 	}
 }
 
-func (s *memoryStore) canGC() (ok bool) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+// Close stops background goroutine, sessions are kept. It is safe to call it
+// more than once.
+func (s *MemoryStore) Close() error {
+	s.once.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+	})
+	return nil
+}
 
-	now := time.Now().UnixNano()
-	if s.gcing {
+// tryGC clears expired sessions in background if there's no janitor, and
+// interval has passed since last run
+func (s *MemoryStore) tryGC() {
+	if s.stop != nil {
 		return
 	}
 
-	// at most 1 times in 1 sec
-	if s.lastgc+int64(time.Second) >= now {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&s.lastgc)
+	if now-last < s.interval || !atomic.CompareAndSwapInt64(&s.lastgc, last, now) {
 		return
 	}
+	go s.gc()
+}
 
-	s.gcing = true
-	s.lastgc = now
-	return true
+func (s *MemoryStore) shard(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
 }
 
-// gc clears all invalid entries using Release, so no lock is required
-func (s *memoryStore) gc() {
-	if !s.canGC() {
-		return
-	}
+func (s *MemoryStore) SetTTL(ttl int) {
+	atomic.StoreInt64(&s.ttl, int64(ttl)*int64(time.Second))
+}
+
+func (s *MemoryStore) Allocate(seed string) (id string, err error) {
+	return s.allocate(seed, atomic.LoadInt64(&s.ttl), 0)
+}
 
-	s.lock.Lock()
-	defer s.lock.Unlock()
+func (s *MemoryStore) AllocateTimed(seed string, ttl, maxAge int) (id string, err error) {
+	return s.allocate(
+		seed,
+		int64(ttl)*int64(time.Second),
+		int64(maxAge)*int64(time.Second),
+	)
+}
 
-	for id, ele := range s.data {
-		if ele.isValid(s.ttl) {
+// reserve takes a slot for new session, evicts least recently used session or
+// clears expired sessions if store is full
+func (s *MemoryStore) reserve() error {
+	swept := false
+	for {
+		cnt := atomic.LoadInt64(&s.count)
+		if s.capacity <= 0 || cnt < s.capacity {
+			if atomic.CompareAndSwapInt64(&s.count, cnt, cnt+1) {
+				return nil
+			}
 			continue
 		}
 
-		s.doRelease(id)
+		switch {
+		case !s.noEvict:
+			if !s.evict() {
+				// slots are reserved by sessions being allocated
+				runtime.Gosched()
+			}
+		case swept:
+			return ErrStoreFull
+		default:
+			// sessions have different ttl and max age, expired ones might
+			// not be least recently used
+			s.gc()
+			swept = true
+		}
 	}
+}
 
-	s.gcing = false
+// evict removes least recently used session, returns false if store is empty
+func (s *MemoryStore) evict() bool {
+	var (
+		victim *memoryShard
+		oldest int64
+	)
+	for _, sh := range s.shards {
+		sh.Lock()
+		if item := sh.data.oldest(); item != nil {
+			if t := item.value.(*memoryElement).lastUsed; victim == nil || t < oldest {
+				victim, oldest = sh, t
+			}
+		}
+		sh.Unlock()
+	}
+	if victim == nil {
+		return false
+	}
+
+	victim.Lock()
+	defer victim.Unlock()
+	if item := victim.data.oldest(); item != nil {
+		s.doRelease(victim, item.key)
+	}
+	return true
 }
 
-func (s *memoryStore) getElement(id string) (*memoryElement, error) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+func (s *MemoryStore) allocate(seed string, ttl, maxAge int64) (id string, err error) {
+	s.tryGC()
+	if err = s.reserve(); err != nil {
+		return "", err
+	}
 
-	e, ok := s.data[id]
-	if !ok {
-		return nil, errors.New("session not exists: " + id)
+	return GenerateRandomKey(32, func(id string) bool {
+		sh := s.shard(id)
+		sh.Lock()
+		defer sh.Unlock()
+
+		if _, ok := sh.data.peek(id); ok {
+			return false
+		}
+
+		sh.data.add(id, newMemEle(seed, ttl, maxAge))
+		return true
+	}), nil
+}
+
+func (s *MemoryStore) Release(id string) {
+	sh := s.shard(id)
+	sh.Lock()
+	defer sh.Unlock()
+
+	s.doRelease(sh, id)
+}
+
+// doRelease removes a session, caller must hold sh's lock
+func (s *MemoryStore) doRelease(sh *memoryShard, id string) {
+	if v, ok := sh.data.remove(id); ok {
+		atomic.AddInt64(&s.count, -1)
+		s.unindex(v.(*memoryElement).owner, id)
 	}
-	return e, nil
 }
 
-func (s *memoryStore) Get(id string) (seed, data string, err error) {
-	e, err := s.getElement(id)
-	if err != nil {
+// unindex removes session from owner index
+func (s *MemoryStore) unindex(owner, id string) {
+	if owner == "" {
 		return
 	}
 
-	e.Lock()
-	defer e.Unlock()
-	if !e.isValid(s.ttl) {
-		return "", "", errors.New("session expired: " + id)
+	s.olock.Lock()
+	defer s.olock.Unlock()
+	ids := s.owners[owner]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(s.owners, owner)
 	}
+}
 
-	seed, data = e.get()
-	return
+// gc clears all invalid entries
+func (s *MemoryStore) gc() {
+	for _, sh := range s.shards {
+		sh.Lock()
+		s.sweep(sh)
+		sh.Unlock()
+	}
+}
+
+// sweep clears invalid entries in sh, caller must hold sh's lock
+func (s *MemoryStore) sweep(sh *memoryShard) {
+	sh.data.each(func(id string, v interface{}) {
+		if !v.(*memoryElement).isValid() {
+			s.doRelease(sh, id)
+		}
+	})
 }
 
-func (s *memoryStore) Set(id string, seed, data string) error {
-	e, err := s.getElement(id)
-	if err != nil {
-		return err
+// withElement calls f with valid session, holding the lock of its shard
+func (s *MemoryStore) withElement(id string, f func(e *memoryElement) error) error {
+	sh := s.shard(id)
+	sh.Lock()
+	defer sh.Unlock()
+
+	v, ok := sh.data.get(id)
+	if !ok {
+		return errors.New("session not exists: " + id)
 	}
 
-	e.Lock()
-	defer e.Unlock()
-	if !e.isValid(s.ttl) {
+	e := v.(*memoryElement)
+	if !e.isValid() {
+		s.doRelease(sh, id)
 		return errors.New("session expired: " + id)
 	}
-	e.set(seed, data)
 
-	return nil
+	return f(e)
 }
 
-// InMemory creates a memory store
-func InMemory(ttl int) Store {
-	ret := &memoryStore{
-		data: make(map[string]*memoryElement),
-		lock: &sync.Mutex{},
+func (s *MemoryStore) Get(id string) (seed, data string, err error) {
+	seed, data, _, err = s.GetTimed(id)
+	return
+}
+
+func (s *MemoryStore) GetTimed(id string) (seed, data string, info Info, err error) {
+	err = s.withElement(id, func(e *memoryElement) error {
+		seed, data = e.get()
+		info = e.info()
+		return nil
+	})
+	return
+}
+
+func (s *MemoryStore) Set(id string, seed, data string) error {
+	return s.withElement(id, func(e *memoryElement) error {
+		e.set(seed, data)
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetVersion(id string, seed, data string, ver int64) error {
+	return s.withElement(id, func(e *memoryElement) error {
+		if e.ver != ver {
+			return ErrConflict
+		}
+		e.set(seed, data)
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetSessionTTL(id string, ttl int) error {
+	return s.withElement(id, func(e *memoryElement) error {
+		e.ttl = int64(ttl) * int64(time.Second)
+		e.lastUsed = time.Now().UnixNano()
+		return nil
+	})
+}
+
+func (s *MemoryStore) Bind(id, owner, ip, userAgent string) error {
+	return s.withElement(id, func(e *memoryElement) error {
+		s.unindex(e.owner, id)
+		e.owner = owner
+		e.ip = ip
+		e.userAgent = userAgent
+		e.lastUsed = time.Now().UnixNano()
+		if owner == "" {
+			return nil
+		}
+
+		s.olock.Lock()
+		defer s.olock.Unlock()
+		if s.owners[owner] == nil {
+			s.owners[owner] = map[string]bool{}
+		}
+		s.owners[owner][id] = true
+		return nil
+	})
+}
+
+// ids returns session ids of the owner
+func (s *MemoryStore) ids(owner string) []string {
+	s.olock.Lock()
+	defer s.olock.Unlock()
+
+	ret := make([]string, 0, len(s.owners[owner]))
+	for id := range s.owners[owner] {
+		ret = append(ret, id)
 	}
-	ret.SetTTL(ttl)
 	return ret
 }
+
+func (s *MemoryStore) List(owner string) ([]Meta, error) {
+	ids := s.ids(owner)
+	ret := make([]Meta, 0, len(ids))
+	for _, id := range ids {
+		sh := s.shard(id)
+		sh.Lock()
+		if v, ok := sh.data.peek(id); ok {
+			e := v.(*memoryElement)
+			if e.isValid() && e.owner == owner {
+				ret = append(ret, e.meta(id))
+			}
+		}
+		sh.Unlock()
+	}
+
+	return ret, nil
+}
+
+func (s *MemoryStore) ReleaseAll(owner string) error {
+	for _, id := range s.ids(owner) {
+		sh := s.shard(id)
+		sh.Lock()
+		if v, ok := sh.data.peek(id); ok && v.(*memoryElement).owner == owner {
+			s.doRelease(sh, id)
+		}
+		sh.Unlock()
+	}
+
+	return nil
+}
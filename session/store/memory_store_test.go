@@ -2,7 +2,10 @@ package store
 
 import (
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestMemoryStore(t *testing.T) {
@@ -80,3 +83,330 @@ func TestMemoryStore(t *testing.T) {
 		}
 	})
 }
+
+func TestMemoryStoreTimed(t *testing.T) {
+	s := InMemory(10).(TimedStore)
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+
+	t.Run("idle timeout", func(t *testing.T) {
+		id, err := s.AllocateTimed(seed, 1, 0)
+		if err != nil {
+			t.Fatalf("cannot allocate: %s", err)
+		}
+
+		time.Sleep(1100 * time.Millisecond)
+		if _, _, err := s.Get(id); err == nil {
+			t.Error("expected session to be expired")
+		}
+	})
+
+	t.Run("absolute timeout", func(t *testing.T) {
+		id, err := s.AllocateTimed(seed, 10, 1)
+		if err != nil {
+			t.Fatalf("cannot allocate: %s", err)
+		}
+
+		time.Sleep(600 * time.Millisecond)
+		if _, _, err := s.Get(id); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		time.Sleep(600 * time.Millisecond)
+		if _, _, err := s.Get(id); err == nil {
+			t.Error("expected session to be expired")
+		}
+	})
+
+	t.Run("set session ttl", func(t *testing.T) {
+		id, err := s.AllocateTimed(seed, 1, 0)
+		if err != nil {
+			t.Fatalf("cannot allocate: %s", err)
+		}
+
+		if err := s.SetSessionTTL(id, 3); err != nil {
+			t.Fatalf("cannot set ttl: %s", err)
+		}
+
+		time.Sleep(1100 * time.Millisecond)
+		_, _, info, err := s.GetTimed(id)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if info.TTL != 3 {
+			t.Errorf("expected ttl to be 3, got %d", info.TTL)
+		}
+	})
+}
+
+func TestMemoryStoreIndexed(t *testing.T) {
+	s := InMemory(10).(IndexedStore)
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+
+	ids := make([]string, 3)
+	for x := range ids {
+		id, err := s.Allocate(seed)
+		if err != nil {
+			t.Fatalf("cannot allocate: %s", err)
+		}
+		ids[x] = id
+	}
+
+	if err := s.Bind(ids[0], "user", "127.0.0.1", "agent 1"); err != nil {
+		t.Fatalf("cannot bind: %s", err)
+	}
+	if err := s.Bind(ids[1], "user", "127.0.0.2", "agent 2"); err != nil {
+		t.Fatalf("cannot bind: %s", err)
+	}
+	if err := s.Bind(ids[2], "another", "127.0.0.3", "agent 3"); err != nil {
+		t.Fatalf("cannot bind: %s", err)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		list, err := s.List("user")
+		if err != nil {
+			t.Fatalf("cannot list: %s", err)
+		}
+		if len(list) != 2 {
+			t.Fatalf("expected 2 sessions, got %d", len(list))
+		}
+		for _, m := range list {
+			if m.ID != ids[0] && m.ID != ids[1] {
+				t.Errorf("unexpected session %s", m.ID)
+			}
+			if m.Owner != "user" || m.IP == "" || m.UserAgent == "" {
+				t.Errorf("unexpected meta: %+v", m)
+			}
+			if m.Created.IsZero() || m.LastSeen.IsZero() {
+				t.Errorf("expected time to be recorded: %+v", m)
+			}
+		}
+	})
+
+	t.Run("release one", func(t *testing.T) {
+		s.Release(ids[0])
+		list, _ := s.List("user")
+		if len(list) != 1 || list[0].ID != ids[1] {
+			t.Errorf("expected only %s left, got %+v", ids[1], list)
+		}
+	})
+
+	t.Run("release all", func(t *testing.T) {
+		if err := s.ReleaseAll("user"); err != nil {
+			t.Fatalf("cannot release: %s", err)
+		}
+		if _, _, err := s.Get(ids[1]); err == nil {
+			t.Error("expected session to be released")
+		}
+		if _, _, err := s.Get(ids[2]); err != nil {
+			t.Errorf("session of another owner should not be released: %s", err)
+		}
+	})
+}
+
+func TestMemoryStoreVersioned(t *testing.T) {
+	s := InMemory(10).(VersionedStore)
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+
+	id, err := s.Allocate(seed)
+	if err != nil {
+		t.Fatalf("cannot allocate: %s", err)
+	}
+
+	_, _, info, _ := s.GetTimed(id)
+	ver := info.Version
+	if err = s.SetVersion(id, seed, "a", ver); err != nil {
+		t.Fatalf("cannot set data: %s", err)
+	}
+	if err = s.SetVersion(id, seed, "b", ver); err != ErrConflict {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	if err = s.Set(id, seed, "c"); err != nil {
+		t.Fatalf("cannot set data: %s", err)
+	}
+	if err = s.SetVersion(id, seed, "d", ver+1); err != ErrConflict {
+		t.Fatalf("expected conflict after overwritten, got %v", err)
+	}
+
+	_, data, info, _ := s.GetTimed(id)
+	if data != "c" || info.Version != ver+2 {
+		t.Errorf("expected data c at version %d, got %s at version %d", ver+2, data, info.Version)
+	}
+}
+
+func TestMemoryStoreCapacity(t *testing.T) {
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+
+	t.Run("evict", func(t *testing.T) {
+		s := NewMemory(10, MemoryOptions{Capacity: 2, Shards: 1})
+		defer s.Close()
+
+		a, _ := s.Allocate(seed)
+		b, _ := s.Allocate(seed)
+		s.Get(a) // b becomes least recently used
+		if _, err := s.Allocate(seed); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if _, _, err := s.Get(a); err != nil {
+			t.Errorf("expected %s to be kept: %s", a, err)
+		}
+		if _, _, err := s.Get(b); err == nil {
+			t.Errorf("expected %s to be evicted", b)
+		}
+	})
+
+	t.Run("no evict", func(t *testing.T) {
+		s := NewMemory(10, MemoryOptions{Capacity: 1, NoEvict: true})
+		defer s.Close()
+
+		if _, err := s.Allocate(seed); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := s.Allocate(seed); err != ErrStoreFull {
+			t.Fatalf("expected ErrStoreFull, got %v", err)
+		}
+
+	})
+
+	t.Run("no evict expired", func(t *testing.T) {
+		s := NewMemory(10, MemoryOptions{Capacity: 1, NoEvict: true})
+		defer s.Close()
+
+		if _, err := s.AllocateTimed(seed, -1, 0); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := s.Allocate(seed); err != nil {
+			t.Fatalf("expected expired session to be evicted, got %v", err)
+		}
+	})
+
+	t.Run("no evict expired not oldest", func(t *testing.T) {
+		s := NewMemory(10, MemoryOptions{Capacity: 2, Shards: 1, NoEvict: true})
+		defer s.Close()
+
+		if _, err := s.Allocate(seed); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := s.AllocateTimed(seed, -1, 0); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := s.Allocate(seed); err != nil {
+			t.Fatalf("expected expired session to be swept, got %v", err)
+		}
+		if _, err := s.Allocate(seed); err != ErrStoreFull {
+			t.Fatalf("expected ErrStoreFull, got %v", err)
+		}
+	})
+
+	t.Run("no evict sharded", func(t *testing.T) {
+		s := NewMemory(10, MemoryOptions{Capacity: 100, NoEvict: true})
+		defer s.Close()
+
+		for x := 0; x < 100; x++ {
+			if _, err := s.Allocate(seed); err != nil {
+				t.Fatalf("expected %d sessions to be allocated, got %v at %d", 100, err, x)
+			}
+		}
+		if _, err := s.Allocate(seed); err != ErrStoreFull {
+			t.Fatalf("expected ErrStoreFull, got %v", err)
+		}
+	})
+
+	t.Run("evict sharded", func(t *testing.T) {
+		s := NewMemory(10, MemoryOptions{Capacity: 32})
+		defer s.Close()
+
+		ids := make([]string, 32)
+		for x := range ids {
+			ids[x], _ = s.Allocate(seed)
+		}
+		for _, id := range ids[1:] {
+			s.Get(id)
+		}
+		for x := 0; x < 16; x++ {
+			if _, err := s.Allocate(seed); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+
+		if _, _, err := s.Get(ids[0]); err == nil {
+			t.Errorf("expected least recently used session to be evicted")
+		}
+		for _, id := range ids[17:] {
+			if _, _, err := s.Get(id); err != nil {
+				t.Errorf("expected %s to be kept: %s", id, err)
+			}
+		}
+		if cnt := atomic.LoadInt64(&s.count); cnt != 32 {
+			t.Errorf("expected 32 sessions, got %d", cnt)
+		}
+	})
+}
+
+func TestMemoryStoreGC(t *testing.T) {
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+	s := NewMemory(10, MemoryOptions{GCInterval: 10 * time.Millisecond})
+	defer s.Close()
+
+	s.AllocateTimed(seed, -1, 0)
+	time.Sleep(50 * time.Millisecond)
+
+	cnt := 0
+	for _, sh := range s.shards {
+		sh.Lock()
+		cnt += sh.data.len()
+		sh.Unlock()
+	}
+	if cnt != 0 {
+		t.Errorf("expected expired session to be cleared, got %d sessions", cnt)
+	}
+}
+
+func TestInMemoryGC(t *testing.T) {
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+	s := InMemory(10).(*MemoryStore)
+	if s.stop != nil {
+		t.Fatal("expected no background goroutine")
+	}
+
+	id, _ := s.AllocateTimed(seed, -1, 0)
+	atomic.StoreInt64(&s.lastgc, 0)
+	s.Allocate(seed)
+	time.Sleep(10 * time.Millisecond)
+
+	sh := s.shard(id)
+	sh.Lock()
+	_, ok := sh.data.peek(id)
+	sh.Unlock()
+	if ok {
+		t.Error("expected expired session to be cleared when allocating")
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	seed := strings.Repeat(string(SeedChars[0]), SeedLength)
+	s := NewMemory(10, MemoryOptions{Capacity: 64, GCInterval: time.Millisecond})
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for x := 0; x < 8; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := 0; y < 100; y++ {
+				id, err := s.Allocate(seed)
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+				s.Set(id, seed, "data")
+				s.Bind(id, "owner", "", "")
+				s.Get(id)
+				s.List("owner")
+				if y%10 == 0 {
+					s.ReleaseAll("owner")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,199 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ronmi/rtoolkit/session/store"
+)
+
+// legacyStore uses tables created for NewStore, see NewStore for detail
+type legacyStore struct {
+	ttl     int64 // accessed atomically
+	stmtGet *sql.Stmt
+	stmtPut *sql.Stmt
+	stmtTTL *sql.Stmt
+	stmtCLR *sql.Stmt
+	stmtNEW *sql.Stmt
+	stmtGC  *sql.Stmt
+	lastgc  int64 // unix timestamp in seconds, accessed atomically
+}
+
+// NewStore creates a MySQL store with table created for previous versions,
+// which has only following columns:
+//
+//   - expire column MUST be TIMESTAMP type.
+//   - sessID column MUST be PRIMARY KEY or UNIQUE KEY.
+//   - data column MUST be TEXT type.
+//   - ttl column MUST be INT types.
+//   - sessID and seed column MUST be CHAR(32) or VARCHAR(32) type.
+//
+// Here's an example:
+//
+//    CREATE session_storage (
+//      sid CHAR(32) PRIMARY KEY,
+//      seed CHAR(32),
+//      data TEXT,
+//      ttl INT(8),
+//      expire TIMESTAMP,
+//      INDEX time_to_live (expire ASC)
+//    ) DEFAULT CHARACTER SET utf8 DEFAULT COLLATE utf8_general_ci;
+//
+// Returned store implements only store.Store, so per-session ttl, max age,
+// listing and versioning are not supported. Expired sessions are cleared when
+// allocating, no background goroutine is started. It panics if table or
+// columns are incorrect.
+//
+// Deprecated: Use NewStoreWithSchema instead. The table must be migrated, see
+// package document for detail.
+func NewStore(db *sql.DB, table, sessID, seed, data, ttl, expire string) store.Store {
+	ret := &legacyStore{
+		lastgc: time.Now().Unix(),
+	}
+	p := func(qstr string) *sql.Stmt {
+		ret, err := db.Prepare(qstr)
+		if err != nil {
+			panic(err)
+		}
+
+		return ret
+	}
+
+	qstr := fmt.Sprintf(
+		"SELECT `%s`,`%s` FROM `%s` WHERE `%s`=? AND `%s`>NOW()",
+		seed,
+		data,
+		table,
+		sessID,
+		expire,
+	)
+	ret.stmtGet = p(qstr)
+
+	qstr = fmt.Sprintf(
+		"UPDATE `%s` SET `%s`=?,`%s`=?,`%s`=?,`%s`=DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE `%s`=? AND `%s`>NOW() LIMIT 1",
+		table,
+		seed,
+		data,
+		ttl,
+		expire,
+		sessID,
+		expire,
+	)
+	ret.stmtPut = p(qstr)
+
+	qstr = fmt.Sprintf(
+		"UPDATE `%s` SET `%s`=DATE_ADD(NOW(), INTERVAL `%s` SECOND) WHERE `%s`=? LIMIT 1",
+		table,
+		expire,
+		ttl,
+		sessID,
+	)
+	ret.stmtTTL = p(qstr)
+
+	qstr = fmt.Sprintf(
+		"DELETE FROM `%s` WHERE `%s`=?",
+		table,
+		sessID,
+	)
+	ret.stmtCLR = p(qstr)
+
+	qstr = fmt.Sprintf(
+		"INSERT IGNORE INTO `%s` (`%s`,`%s`,`%s`,`%s`,`%s`) VALUES (?,?,'',?,DATE_ADD(NOW(), INTERVAL ? SECOND))",
+		table,
+		sessID,
+		seed,
+		data,
+		ttl,
+		expire,
+	)
+	ret.stmtNEW = p(qstr)
+
+	qstr = fmt.Sprintf(
+		"DELETE FROM `%s` WHERE NOW() > `%s`",
+		table,
+		expire,
+	)
+	ret.stmtGC = p(qstr)
+	return ret
+}
+
+// SetTTL decides how long before data to be considered invalid (in seconds)
+func (s *legacyStore) SetTTL(ttl int) {
+	atomic.StoreInt64(&s.ttl, int64(ttl))
+}
+
+func (s *legacyStore) tryGC() {
+	t := time.Now().Unix()
+	last := atomic.LoadInt64(&s.lastgc)
+	if t < last+atomic.LoadInt64(&s.ttl) || !atomic.CompareAndSwapInt64(&s.lastgc, last, t) {
+		return
+	}
+
+	s.stmtGC.Exec()
+}
+
+func (s *legacyStore) tryInsert(sid, seed string) (bool, error) {
+	s.tryGC()
+	ttl := atomic.LoadInt64(&s.ttl)
+	res, err := s.stmtNEW.Exec(sid, seed, ttl, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return cnt == 1, nil
+}
+
+func (s *legacyStore) Allocate(seed string) (string, error) {
+	var err error
+	sid := store.GenerateRandomKey(32, func(id string) bool {
+		var ret bool
+		ret, err = s.tryInsert(id, seed)
+		if err != nil {
+			return true
+		}
+
+		return ret
+	})
+
+	return sid, err
+}
+
+func (s *legacyStore) Get(sessID string) (seed, data string, err error) {
+	if err = s.stmtGet.QueryRow(sessID).Scan(&seed, &data); err != nil {
+		if err == sql.ErrNoRows {
+			err = errors.New("rtoolkit/session/store/mysql: session not exists: " + sessID)
+		}
+		return
+	}
+
+	_, err = s.stmtTTL.Exec(sessID)
+	return
+}
+
+func (s *legacyStore) Set(sessID string, seed, data string) error {
+	ttl := atomic.LoadInt64(&s.ttl)
+	res, err := s.stmtPut.Exec(seed, data, ttl, ttl, sessID)
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports changed rows, so saving same data in same second
+	// affects nothing
+	if cnt, err := res.RowsAffected(); err != nil || cnt > 0 {
+		return err
+	}
+	_, _, err = s.Get(sessID)
+	return err
+}
+
+func (s *legacyStore) Release(sessID string) {
+	s.stmtCLR.Exec(sessID)
+}
@@ -1,195 +1,117 @@
-package mysql
-
-import (
-	"database/sql"
-	"fmt"
-	"time"
-
-	"github.com/Ronmi/rtoolkit/session/store"
-)
-
-type mysqlStore struct {
-	ttl     int
-	conn    *sql.DB
-	stmtGet *sql.Stmt
-	stmtPut *sql.Stmt
-	stmtTTL *sql.Stmt
-	stmtCLR *sql.Stmt
-	stmtNEW *sql.Stmt
-	stmtGC  *sql.Stmt
-	lastgc  int64 // unix timestamp, in seconds
-}
-
-// NewStore creates a MySQL store. You have to fill table and columns.
+// Package mysql implements MySQL based session store
 //
-// There are few restrictions:
+// Time related columns are stored as unix timestamp (in seconds), see
+// CreateTable for detail.
 //
-//   - expire column MUST be TIMESTAMP type.
-//   - sessID column MUST be PRIMARY KEY or UNIQUE KEY.
-//   - data column MUST be TEXT type.
-//   - ttl column MUST be INT types.
-//   - sessID and seed column MUST be CHAR(32) or VARCHAR(32) type.
+// Tables created for NewStore (before per-session lifetime and listing) have
+// only session id, seed, data, ttl and expire columns, and expire column is
+// TIMESTAMP type. The easiest way to upgrade is dropping the table and
+// creating a new one with CreateTable, which logs out every user. To keep
+// existing sessions, migrate the table with (use your own table and column
+// names):
 //
-// Here's an example:
+//    ALTER TABLE session_storage
+//      ADD COLUMN max_age INT NOT NULL DEFAULT 0,
+//      ADD COLUMN created BIGINT NOT NULL DEFAULT 0,
+//      ADD COLUMN expire_unix BIGINT NOT NULL DEFAULT 0,
+//      ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT '',
+//      ADD COLUMN ip VARCHAR(45) NOT NULL DEFAULT '',
+//      ADD COLUMN ua VARCHAR(255) NOT NULL DEFAULT '',
+//      ADD COLUMN last_seen BIGINT NOT NULL DEFAULT 0,
+//      ADD COLUMN ver BIGINT NOT NULL DEFAULT 0;
+//    UPDATE session_storage SET
+//      expire_unix = UNIX_TIMESTAMP(expire),
+//      created = UNIX_TIMESTAMP(),
+//      last_seen = UNIX_TIMESTAMP();
+//    ALTER TABLE session_storage
+//      DROP COLUMN expire,
+//      CHANGE expire_unix expire BIGINT NOT NULL,
+//      ADD INDEX session_storage_expire (expire),
+//      ADD INDEX session_storage_owner (owner);
 //
-//    CREATE session_storage (
-//      sid CHAR(32) PRIMARY KEY,
-//      seed CHAR(32),
-//      data TEXT,
-//      ttl INT(8),
-//      expire TIMESTAMP,
-//      INDEX time_to_live (expire ASC)
-//    ) DEFAULT CHARACTER SET utf8 DEFAULT COLLATE utf8_general_ci;
-func NewStore(db *sql.DB, table, sessID, seed, data, ttl, expire string) store.Store {
-	ret := &mysqlStore{
-		conn:   db,
-		lastgc: time.Now().Unix(),
-	}
-	p := func(qstr string) *sql.Stmt {
-		ret, err := db.Prepare(qstr)
-		if err != nil {
-			panic(err)
-		}
-
-		return ret
-	}
-
-	qstr := fmt.Sprintf(
-		"SELECT `%s`,`%s` FROM `%s` WHERE `%s`=?",
-		seed,
-		data,
-		table,
-		sessID,
-	)
-	ret.stmtGet = p(qstr)
-
-	qstr = fmt.Sprintf(
-		"INSERT INTO `%s` (`%s`,`%s`,`%s`,`%s`,`%s`) VALUES (?,?,?,?,NOW()) ON DUPLICATE KEY UPDATE `%s`=VALUES(`%s`),`%s`=VALUES(`%s`),`%s`=VALUES(`%s`),`%s`=NOW()",
-		table,
-		sessID,
-		seed,
-		data,
-		ttl,
-		expire,
-		seed, seed,
-		data, data,
-		ttl, ttl,
-		expire,
-	)
-	ret.stmtPut = p(qstr)
-
-	qstr = fmt.Sprintf(
-		"UPDATE `%s` SET `%s`=?, `%s`=DATE_ADD(NOW(), INTERVAL `%s` SECOND) WHERE `%s`=? LIMIT 1",
-		table,
-		ttl,
-		expire,
-		ttl,
-		sessID,
-	)
-	ret.stmtTTL = p(qstr)
-
-	qstr = fmt.Sprintf(
-		"DELETE FROM `%s` WHERE `%s`=?",
-		table,
-		sessID,
-	)
-	ret.stmtCLR = p(qstr)
-
-	qstr = fmt.Sprintf(
-		"INSERT INTO `%s` (`%s`,`%s`,`%s`,`%s`,`%s`) VALUES (?,?,'',?,DATE_ADD(NOW(), INTERVAL `%s` SECOND))",
-		table,
-		sessID,
-		seed,
-		data,
-		ttl,
-		expire,
-		ttl,
-	)
-	ret.stmtNEW = p(qstr)
-
-	qstr = fmt.Sprintf(
-		"DELETE FROM `%s` WHERE NOW() > `%s`",
-		table,
-		expire,
-	)
-	ret.stmtGC = p(qstr)
-	return ret
-}
-
-// SetTTL decides how long before data to be considered invalid (in seconds)
-func (s *mysqlStore) SetTTL(ttl int) {
-	s.ttl = ttl
-}
+// Existing sessions keep working: they have no max age, and are created at
+// the time of migration. NewStore still works with tables not migrated, but
+// it does not support features like per-session lifetime.
+package mysql
 
-func (s *mysqlStore) tryGC() {
-	t := time.Now().Unix()
-	if t < s.lastgc+int64(s.ttl) {
-		return
-	}
+import (
+	"database/sql"
+	"strings"
 
-	s.lastgc = t
-	s.stmtGC.Exec()
-}
+	"github.com/Ronmi/rtoolkit/session/store/internal/sqlstore"
+)
 
-func (s *mysqlStore) tryInsert(sid, seed string) (bool, error) {
-	s.tryGC()
-	res, err := s.stmtNEW.Exec(sid, seed, s.ttl)
-	if err != nil {
-		return false, err
-	}
+// Schema defines table and column names used by the store
+type Schema = sqlstore.Schema
 
-	cnt, err := res.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-	if cnt != 1 {
-		return false, nil
-	}
+// DefaultSchema is the schema used by CreateTable example
+var DefaultSchema = sqlstore.DefaultSchema
 
-	return true, nil
+var dialect = sqlstore.Dialect{
+	Now: "UNIX_TIMESTAMP()",
+	Quote: func(name string) string {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	},
+	InsertIgnore: true,
+	Expire:       "IF({max_age} > 0 AND {created} + {max_age} < {now} + {ttl}, {created} + {max_age}, {now} + {ttl})",
+	ChangedRows:  true,
 }
 
-// Allocate creates a new session id, returns error if store is full
+// Store is a MySQL session store, implements store.VersionedStore,
+// store.IndexedStore and store.ContextStore
 //
-// Size of session id depends on store.
-//
-// Implementation MUST allocate space for the session id before returning it,
-// and ttl value MUST follow what was set by SetTTL().
-//
-// seed is used for session validating, see session.Manager.Start() for detail
-func (s *mysqlStore) Allocate(seed string) (string, error) {
-	var err error
-	sid := store.GenerateRandomKey(32, func(id string) bool {
-		var ret bool
-		ret, err = s.tryInsert(id, seed)
-		if err != nil {
-			return true
-		}
-
-		return ret
-	})
-
-	return sid, err
+// Expired sessions are cleared by a background goroutine every minute, call
+// Close() to stop it.
+type Store struct {
+	*sqlstore.Store
 }
 
-// Get returns session data (string), returns error if not found or something goes wrong
+// NewStoreWithSchema creates a MySQL store. You have to fill table and columns
+// in schema, and create the table (see CreateTable) before calling it.
 //
-// It MUST refresh ttl value.
-func (s *mysqlStore) Get(sessID string) (seed, data string, err error) {
-	res := s.stmtGet.QueryRow(sessID)
-	err = res.Scan(&seed, &data)
-	return
+// It panics if table or columns are incorrect.
+func NewStoreWithSchema(db *sql.DB, schema Schema) *Store {
+	return &Store{sqlstore.New(db, schema, dialect, "rtoolkit/session/store/mysql")}
 }
 
-// Set saves session data, returns error if not found or something goes wrong
+// CreateTable creates the table and indexes if not exist
 //
-// It MUST refresh ttl value.
-func (s *mysqlStore) Set(sessID string, seed, data string) error {
-	_, err := s.stmtPut.Exec(sessID, seed, data, s.ttl)
+// With DefaultSchema, it executes following SQL:
+//
+//    CREATE TABLE IF NOT EXISTS `session_storage` (
+//      `sid` VARCHAR(64) PRIMARY KEY,
+//      `seed` VARCHAR(32) NOT NULL,
+//      `data` TEXT NOT NULL,
+//      `ttl` INT NOT NULL,
+//      `max_age` INT NOT NULL DEFAULT 0,
+//      `created` BIGINT NOT NULL,
+//      `expire` BIGINT NOT NULL,
+//      `owner` VARCHAR(255) NOT NULL DEFAULT '',
+//      `ip` VARCHAR(45) NOT NULL DEFAULT '',
+//      `ua` VARCHAR(255) NOT NULL DEFAULT '',
+//      `last_seen` BIGINT NOT NULL,
+//      `ver` BIGINT NOT NULL DEFAULT 0,
+//      INDEX `session_storage_expire` (`expire`),
+//      INDEX `session_storage_owner` (`owner`)
+//    ) DEFAULT CHARACTER SET utf8mb4;
+func CreateTable(db *sql.DB, schema Schema) error {
+	qstr := "CREATE TABLE IF NOT EXISTS {table} (\n" +
+		"  {id} VARCHAR(64) PRIMARY KEY,\n" +
+		"  {seed} VARCHAR(32) NOT NULL,\n" +
+		"  {data} TEXT NOT NULL,\n" +
+		"  {ttl} INT NOT NULL,\n" +
+		"  {max_age} INT NOT NULL DEFAULT 0,\n" +
+		"  {created} BIGINT NOT NULL,\n" +
+		"  {expire} BIGINT NOT NULL,\n" +
+		"  {owner} VARCHAR(255) NOT NULL DEFAULT '',\n" +
+		"  {ip} VARCHAR(45) NOT NULL DEFAULT '',\n" +
+		"  {ua} VARCHAR(255) NOT NULL DEFAULT '',\n" +
+		"  {last_seen} BIGINT NOT NULL,\n" +
+		"  {ver} BIGINT NOT NULL DEFAULT 0,\n" +
+		"  INDEX " + dialect.Quote(schema.Table+"_expire") + " ({expire}),\n" +
+		"  INDEX " + dialect.Quote(schema.Table+"_owner") + " ({owner})\n" +
+		") DEFAULT CHARACTER SET utf8mb4"
+
+	_, err := db.Exec(dialect.Build(schema, qstr))
 	return err
 }
-
-// Release clears a session, never fail
-func (s *mysqlStore) Release(sessID string) {
-	s.stmtCLR.Exec(sessID)
-}
@@ -2,49 +2,136 @@ package mysql
 
 import (
 	"database/sql"
-	"log"
 	"os"
+	"sync"
 	"testing"
 
+	"github.com/Ronmi/rtoolkit/session/store"
+	"github.com/Ronmi/rtoolkit/session/store/storetest"
 	_ "github.com/go-sql-driver/mysql"
 )
 
-var db *sql.DB
+var (
+	db     *sql.DB
+	dbErr  error
+	dbOnce sync.Once
+)
 
-func init() {
+// testSchema creates the table in database of MYSQL_DSN, skips the test if
+// MYSQL_DSN is not set
+func testSchema(t *testing.T) Schema {
 	dsn := os.Getenv("MYSQL_DSN")
 	if dsn == "" {
-		log.Fatal("You must set MYSQL_DSN before running test")
+		t.Skip("MYSQL_DSN is not set")
+	}
+
+	dbOnce.Do(func() {
+		if db, dbErr = sql.Open("mysql", dsn); dbErr == nil {
+			db.Exec("DROP TABLE IF EXISTS session_store")
+		}
+	})
+	if dbErr != nil {
+		t.Fatalf("cannot connect to mysql: %s", dbErr)
+	}
+
+	schema := DefaultSchema
+	schema.Table = "session_store"
+	if err := CreateTable(db, schema); err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	return schema
+}
+
+func createStore(t *testing.T) *Store {
+	s := NewStoreWithSchema(db, testSchema(t))
+	t.Cleanup(func() { s.Close() })
+	s.SetTTL(60)
+	return s
+}
+
+func TestSchema(t *testing.T) {
+	schema := testSchema(t)
+	if err := CreateTable(db, schema); err != nil {
+		t.Fatalf("cannot create existing table: %s", err)
 	}
 
-	var err error
-	db, err = sql.Open("mysql", dsn)
+	s := NewStoreWithSchema(db, schema)
+	defer s.Close()
+	s.SetTTL(60)
+	seed := "ineedaseedbutidontknowwhatwillbe"
+	live, _ := s.Allocate(seed)
+	dead, _ := s.AllocateTimed(seed, -1, 0)
+
+	// expire is unix timestamp computed by database
+	var diff int64
+	err := db.QueryRow(
+		"SELECT `expire` - UNIX_TIMESTAMP() FROM `session_store` WHERE `sid` = ?",
+		live,
+	).Scan(&diff)
 	if err != nil {
-		log.Fatalf("Cannot connect to mysql: %s", err)
+		t.Fatalf("cannot read expire: %s", err)
+	}
+	if diff < 59 || diff > 60 {
+		t.Errorf("expected session to expire in 60 seconds, got %d", diff)
 	}
 
-	db.Exec("DROP TABLE IF EXISTS session_store")
-	qstr := `CREATE TABLE session_store (
-  sid CHAR(32) PRIMARY KEY,
-  seed CHAR(32),
+	if err = s.GC(); err != nil {
+		t.Fatalf("unexpected error running gc: %s", err)
+	}
+	var cnt int
+	err = db.QueryRow(
+		"SELECT COUNT(*) FROM `session_store` WHERE `sid` IN (?, ?)",
+		live, dead,
+	).Scan(&cnt)
+	if err != nil {
+		t.Fatalf("cannot count sessions: %s", err)
+	}
+	if cnt != 1 {
+		t.Errorf("expected expired session to be deleted, got %d sessions", cnt)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	schema := testSchema(t)
+	storetest.Run(t, func() store.Store {
+		return NewStoreWithSchema(db, schema)
+	})
+}
+
+func TestDeprecatedNewStore(t *testing.T) {
+	testSchema(t)
+	db.Exec("DROP TABLE IF EXISTS session_legacy")
+	_, err := db.Exec(`CREATE TABLE session_legacy (
+  sid VARCHAR(64) PRIMARY KEY,
+  seed VARCHAR(32),
   data TEXT,
   ttl INT(8),
   expire TIMESTAMP,
   INDEX time_to_live (expire ASC)
-) DEFAULT CHARACTER SET utf8 DEFAULT COLLATE utf8_general_ci`
-	db.Exec(qstr)
-}
+)`)
+	if err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
 
-func createStore() *mysqlStore {
-	return NewStore(db, "session_store", "sid", "seed", "data", "ttl", "expire").(*mysqlStore)
+	// table created for previous versions works without migration
+	storetest.Run(t, func() store.Store {
+		return NewStore(db, "session_legacy", "sid", "seed", "data", "ttl", "expire")
+	})
 }
 
-func TestAllocate(t *testing.T) {
-	s := createStore()
+func TestRefreshTwice(t *testing.T) {
+	s := createStore(t)
 	seed := "ineedaseedbutidontknowwhatwillbe"
 
-	_, err := s.Allocate(seed)
-	if err != nil {
-		t.Fatalf("error occured allocating storage: %s", err)
+	id, _ := s.Allocate(seed)
+	for x := 0; x < 2; x++ {
+		// nothing is changed by second refresh in same second
+		if _, _, err := s.Get(id); err != nil {
+			t.Fatalf("unexpected error at #%d: %s", x, err)
+		}
+	}
+	if _, _, err := s.Get("not exist"); err == nil {
+		t.Error("expected error for missing session")
 	}
 }
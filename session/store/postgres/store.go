@@ -0,0 +1,88 @@
+// Package postgres implements PostgreSQL based session store
+//
+// Time related columns are stored as unix timestamp (in seconds), see
+// CreateTable for detail.
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/Ronmi/rtoolkit/session/store/internal/sqlstore"
+)
+
+// Schema defines table and column names used by the store
+type Schema = sqlstore.Schema
+
+// DefaultSchema is the schema used by CreateTable example
+var DefaultSchema = sqlstore.DefaultSchema
+
+var dialect = sqlstore.Dialect{
+	Now:         "CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT)",
+	Placeholder: sqlstore.DollarPlaceholder,
+}
+
+// Store is a PostgreSQL session store, implements store.VersionedStore,
+// store.IndexedStore and store.ContextStore
+//
+// Expired sessions are cleared by a background goroutine every minute, call
+// Close() to stop it.
+type Store struct {
+	*sqlstore.Store
+}
+
+// NewStore creates a PostgreSQL store. You have to fill table and columns in
+// schema, and create the table (see CreateTable) before calling it.
+//
+// It panics if table or columns are incorrect.
+func NewStore(db *sql.DB, schema Schema) *Store {
+	return &Store{sqlstore.New(db, schema, dialect, "rtoolkit/session/store/postgres")}
+}
+
+// CreateTable creates the table and indexes if not exist
+//
+// With DefaultSchema, it executes following SQL:
+//
+//    CREATE TABLE IF NOT EXISTS "session_storage" (
+//      "sid" VARCHAR(64) PRIMARY KEY,
+//      "seed" VARCHAR(32) NOT NULL,
+//      "data" TEXT NOT NULL DEFAULT '',
+//      "ttl" INTEGER NOT NULL,
+//      "max_age" INTEGER NOT NULL DEFAULT 0,
+//      "created" BIGINT NOT NULL,
+//      "expire" BIGINT NOT NULL,
+//      "owner" VARCHAR(255) NOT NULL DEFAULT '',
+//      "ip" VARCHAR(45) NOT NULL DEFAULT '',
+//      "ua" TEXT NOT NULL DEFAULT '',
+//      "last_seen" BIGINT NOT NULL,
+//      "ver" BIGINT NOT NULL DEFAULT 0
+//    );
+//    CREATE INDEX IF NOT EXISTS "session_storage_expire" ON "session_storage" ("expire");
+//    CREATE INDEX IF NOT EXISTS "session_storage_owner" ON "session_storage" ("owner");
+func CreateTable(db *sql.DB, schema Schema) error {
+	qstrs := []string{
+		`CREATE TABLE IF NOT EXISTS {table} (
+  {id} VARCHAR(64) PRIMARY KEY,
+  {seed} VARCHAR(32) NOT NULL,
+  {data} TEXT NOT NULL DEFAULT '',
+  {ttl} INTEGER NOT NULL,
+  {max_age} INTEGER NOT NULL DEFAULT 0,
+  {created} BIGINT NOT NULL,
+  {expire} BIGINT NOT NULL,
+  {owner} VARCHAR(255) NOT NULL DEFAULT '',
+  {ip} VARCHAR(45) NOT NULL DEFAULT '',
+  {ua} TEXT NOT NULL DEFAULT '',
+  {last_seen} BIGINT NOT NULL,
+  {ver} BIGINT NOT NULL DEFAULT 0
+)`,
+		`CREATE INDEX IF NOT EXISTS "` + schema.Table + `_expire" ON {table} ({expire})`,
+		`CREATE INDEX IF NOT EXISTS "` + schema.Table + `_owner" ON {table} ({owner})`,
+	}
+
+	for _, qstr := range qstrs {
+		if _, err := db.Exec(dialect.Build(schema, qstr)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Ronmi/rtoolkit/session/store"
+	"github.com/Ronmi/rtoolkit/session/store/storetest"
+	_ "github.com/lib/pq"
+)
+
+var (
+	db     *sql.DB
+	dbErr  error
+	dbOnce sync.Once
+)
+
+// testSchema creates the table in database of PGSQL_DSN, skips the test if
+// PGSQL_DSN is not set
+func testSchema(t *testing.T) Schema {
+	dsn := os.Getenv("PGSQL_DSN")
+	if dsn == "" {
+		t.Skip("PGSQL_DSN is not set")
+	}
+
+	dbOnce.Do(func() {
+		if db, dbErr = sql.Open("postgres", dsn); dbErr == nil {
+			db.Exec(`DROP TABLE IF EXISTS "session_store"`)
+		}
+	})
+	if dbErr != nil {
+		t.Fatalf("cannot connect to postgresql: %s", dbErr)
+	}
+
+	schema := DefaultSchema
+	schema.Table = "session_store"
+	if err := CreateTable(db, schema); err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	return schema
+}
+
+func TestSchema(t *testing.T) {
+	schema := testSchema(t)
+	if err := CreateTable(db, schema); err != nil {
+		t.Fatalf("cannot create existing table: %s", err)
+	}
+
+	s := NewStore(db, schema)
+	defer s.Close()
+	s.SetTTL(60)
+	seed := "ineedaseedbutidontknowwhatwillbe"
+	live, _ := s.Allocate(seed)
+	dead, _ := s.AllocateTimed(seed, -1, 0)
+
+	// expire is unix timestamp computed by database
+	var diff int64
+	err := db.QueryRow(
+		`SELECT "expire" - CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT) FROM "session_store" WHERE "sid" = $1`,
+		live,
+	).Scan(&diff)
+	if err != nil {
+		t.Fatalf("cannot read expire: %s", err)
+	}
+	if diff < 59 || diff > 60 {
+		t.Errorf("expected session to expire in 60 seconds, got %d", diff)
+	}
+
+	if err = s.GC(); err != nil {
+		t.Fatalf("unexpected error running gc: %s", err)
+	}
+	var cnt int
+	err = db.QueryRow(
+		`SELECT COUNT(*) FROM "session_store" WHERE "sid" IN ($1, $2)`,
+		live, dead,
+	).Scan(&cnt)
+	if err != nil {
+		t.Fatalf("cannot count sessions: %s", err)
+	}
+	if cnt != 1 {
+		t.Errorf("expected expired session to be deleted, got %d sessions", cnt)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	schema := testSchema(t)
+	storetest.Run(t, func() store.Store {
+		return NewStore(db, schema)
+	})
+}
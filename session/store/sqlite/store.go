@@ -0,0 +1,91 @@
+// Package sqlite implements SQLite based session store
+//
+// Time related columns are stored as unix timestamp (in seconds), see
+// CreateTable for detail.
+//
+// SQLite allows only one writer at a time, you might want to set busy timeout
+// in DSN (like "_busy_timeout=5000" for github.com/mattn/go-sqlite3) to prevent
+// "database is locked" errors under heavy load.
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/Ronmi/rtoolkit/session/store/internal/sqlstore"
+)
+
+// Schema defines table and column names used by the store
+type Schema = sqlstore.Schema
+
+// DefaultSchema is the schema used by CreateTable example
+var DefaultSchema = sqlstore.DefaultSchema
+
+var dialect = sqlstore.Dialect{
+	Now: "CAST(strftime('%s', 'now') AS INTEGER)",
+}
+
+// Store is a SQLite session store, implements store.VersionedStore,
+// store.IndexedStore and store.ContextStore
+//
+// Expired sessions are cleared by a background goroutine every minute, call
+// Close() to stop it.
+type Store struct {
+	*sqlstore.Store
+}
+
+// NewStore creates a SQLite store. You have to fill table and columns in
+// schema, and create the table (see CreateTable) before calling it.
+//
+// It panics if table or columns are incorrect.
+func NewStore(db *sql.DB, schema Schema) *Store {
+	return &Store{sqlstore.New(db, schema, dialect, "rtoolkit/session/store/sqlite")}
+}
+
+// CreateTable creates the table and indexes if not exist
+//
+// With DefaultSchema, it executes following SQL:
+//
+//    CREATE TABLE IF NOT EXISTS "session_storage" (
+//      "sid" TEXT PRIMARY KEY,
+//      "seed" TEXT NOT NULL,
+//      "data" TEXT NOT NULL DEFAULT '',
+//      "ttl" INTEGER NOT NULL,
+//      "max_age" INTEGER NOT NULL DEFAULT 0,
+//      "created" INTEGER NOT NULL,
+//      "expire" INTEGER NOT NULL,
+//      "owner" TEXT NOT NULL DEFAULT '',
+//      "ip" TEXT NOT NULL DEFAULT '',
+//      "ua" TEXT NOT NULL DEFAULT '',
+//      "last_seen" INTEGER NOT NULL,
+//      "ver" INTEGER NOT NULL DEFAULT 0
+//    );
+//    CREATE INDEX IF NOT EXISTS "session_storage_expire" ON "session_storage" ("expire");
+//    CREATE INDEX IF NOT EXISTS "session_storage_owner" ON "session_storage" ("owner");
+func CreateTable(db *sql.DB, schema Schema) error {
+	qstrs := []string{
+		`CREATE TABLE IF NOT EXISTS {table} (
+  {id} TEXT PRIMARY KEY,
+  {seed} TEXT NOT NULL,
+  {data} TEXT NOT NULL DEFAULT '',
+  {ttl} INTEGER NOT NULL,
+  {max_age} INTEGER NOT NULL DEFAULT 0,
+  {created} INTEGER NOT NULL,
+  {expire} INTEGER NOT NULL,
+  {owner} TEXT NOT NULL DEFAULT '',
+  {ip} TEXT NOT NULL DEFAULT '',
+  {ua} TEXT NOT NULL DEFAULT '',
+  {last_seen} INTEGER NOT NULL,
+  {ver} INTEGER NOT NULL DEFAULT 0
+)`,
+		`CREATE INDEX IF NOT EXISTS "` + schema.Table + `_expire" ON {table} ({expire})`,
+		`CREATE INDEX IF NOT EXISTS "` + schema.Table + `_owner" ON {table} ({owner})`,
+	}
+
+	for _, qstr := range qstrs {
+		if _, err := db.Exec(dialect.Build(schema, qstr)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/Ronmi/rtoolkit/session/store"
+	"github.com/Ronmi/rtoolkit/session/store/storetest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	fn := filepath.Join(t.TempDir(), "session.db")
+	db, err := sql.Open("sqlite3", fn+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("cannot open database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err = CreateTable(db, DefaultSchema); err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	return db
+}
+
+func TestSchema(t *testing.T) {
+	db := openDB(t)
+	schema := DefaultSchema
+	if err := CreateTable(db, schema); err != nil {
+		t.Fatalf("cannot create existing table: %s", err)
+	}
+
+	s := NewStore(db, schema)
+	defer s.Close()
+	s.SetTTL(60)
+	seed := "ineedaseedbutidontknowwhatwillbe"
+	live, _ := s.Allocate(seed)
+	dead, _ := s.AllocateTimed(seed, -1, 0)
+
+	// expire is unix timestamp computed by database
+	var diff int64
+	err := db.QueryRow(
+		`SELECT "expire" - CAST(strftime('%s', 'now') AS INTEGER) FROM "session_storage" WHERE "sid" = ?`,
+		live,
+	).Scan(&diff)
+	if err != nil {
+		t.Fatalf("cannot read expire: %s", err)
+	}
+	if diff < 59 || diff > 60 {
+		t.Errorf("expected session to expire in 60 seconds, got %d", diff)
+	}
+
+	if err = s.GC(); err != nil {
+		t.Fatalf("unexpected error running gc: %s", err)
+	}
+	var cnt int
+	err = db.QueryRow(
+		`SELECT COUNT(*) FROM "session_storage" WHERE "sid" IN (?, ?)`,
+		live, dead,
+	).Scan(&cnt)
+	if err != nil {
+		t.Fatalf("cannot count sessions: %s", err)
+	}
+	if cnt != 1 {
+		t.Errorf("expected expired session to be deleted, got %d sessions", cnt)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	db := openDB(t)
+	storetest.Run(t, func() store.Store {
+		return NewStore(db, DefaultSchema)
+	})
+}
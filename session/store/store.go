@@ -4,6 +4,8 @@ package store
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"time"
 )
 
 const (
@@ -42,6 +44,113 @@ type Store interface {
 	Release(sessID string)
 }
 
+// Info holds lifetime information of a session
+type Info struct {
+	// Created is the time when the session was allocated
+	Created time.Time
+	// TTL is idle timeout of the session (in seconds)
+	TTL int
+	// MaxAge is absolute lifetime of the session (in seconds), counting
+	// from Created. Zero means no limit.
+	MaxAge int
+	// Version increases by 1 every time session data is written, it is
+	// always zero if the store does not implement VersionedStore.
+	Version int64
+}
+
+// ExpireAt computes when the session expires if it is accessed at t
+func (i Info) ExpireAt(t time.Time) time.Time {
+	ret := t.Add(time.Duration(i.TTL) * time.Second)
+	if i.MaxAge <= 0 {
+		return ret
+	}
+
+	if deadline := i.Created.Add(time.Duration(i.MaxAge) * time.Second); deadline.Before(ret) {
+		return deadline
+	}
+	return ret
+}
+
+// TimedStore is a Store which records creation time and ttl for each session,
+// so every session can have its own idle timeout and absolute lifetime.
+//
+// Get() and Set() MUST refresh a session with its own ttl, which is the value
+// passed to AllocateTimed() or SetSessionTTL().
+//
+// All stores in this package and sub packages implement it.
+type TimedStore interface {
+	Store
+
+	// AllocateTimed is identical to Allocate, but uses ttl instead of the
+	// value set by SetTTL(), and the session becomes invalid after maxAge
+	// seconds since allocated, no matter how often it is accessed. Zero
+	// maxAge means no limit.
+	//
+	// Sessions allocated by Allocate() MUST have zero maxAge.
+	AllocateTimed(seed string, ttl, maxAge int) (string, error)
+
+	// GetTimed is identical to Get, but returns lifetime information too
+	//
+	// It MUST refresh ttl value.
+	GetTimed(sessID string) (seed, data string, info Info, err error)
+
+	// SetSessionTTL changes idle timeout of a session and refreshes it,
+	// returns error if not found or something goes wrong.
+	//
+	// Absolute lifetime is not affected.
+	SetSessionTTL(sessID string, ttl int) error
+}
+
+// ErrConflict is returned by VersionedStore.SetVersion if the session has been
+// modified by others
+var ErrConflict = errors.New("rtoolkit/session/store: session has been modified")
+
+// VersionedStore is a TimedStore supports optimistic concurrency control
+//
+// Version of the session is returned by GetTimed(), and MUST increase by 1
+// every time session data is written by Set() or SetVersion().
+//
+// All stores in this package and sub packages implement it.
+type VersionedStore interface {
+	TimedStore
+
+	// SetVersion is identical to Set, but saves data only if current version
+	// of the session is ver, returns ErrConflict if not.
+	//
+	// Version becomes ver+1 if succeeded.
+	SetVersion(sessID, seed, data string, ver int64) error
+}
+
+// Meta holds information of an active session, see IndexedStore
+type Meta struct {
+	Info
+	ID        string
+	Owner     string
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+}
+
+// IndexedStore is a Store which indexes sessions by owner, so you can list
+// or revoke all sessions of a user.
+//
+// All stores in this package and sub packages implement it.
+type IndexedStore interface {
+	Store
+
+	// Bind associates a session with owner, and records client information.
+	// Returns error if not found or something goes wrong.
+	//
+	// A session has at most one owner, binding again replaces it.
+	Bind(sessID, owner, ip, userAgent string) error
+
+	// List returns active sessions of the owner, in no particular order
+	List(owner string) ([]Meta, error)
+
+	// ReleaseAll clears all sessions of the owner
+	ReleaseAll(owner string) error
+}
+
 // GenerateRandomKey is a helper function to generate random string as session key
 //
 // size is in bytes, and will be carried to multiple of 4 due to base64 encoding.
@@ -0,0 +1,402 @@
+// Package storetest provides conformance tests for session stores
+//
+// Run it in your test to verify your store follows the rules defined in
+// package store:
+//
+//     func TestConformance(t *testing.T) {
+//         storetest.Run(t, func() store.Store {
+//             return NewMyStore()
+//         })
+//     }
+//
+// Optional interfaces (store.TimedStore, store.VersionedStore,
+// store.IndexedStore and store.ContextStore) are tested only if implemented.
+// Stores implementing io.Closer are closed after each test.
+//
+// Tests are run in parallel, each with a store created by the factory. Some
+// tests wait for sessions to expire, so it takes several seconds.
+package storetest
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ronmi/rtoolkit/session/store"
+)
+
+// Factory creates a store for testing. Stores created by same factory might
+// share same storage, tests never depend on sessions created by others.
+type Factory func() store.Store
+
+func genSeed() string {
+	ret := make([]byte, store.SeedLength)
+	for x := range ret {
+		ret[x] = store.SeedChars[rand.Intn(len(store.SeedChars))]
+	}
+	return string(ret)
+}
+
+// Run runs all conformance tests against stores created by f
+func Run(t *testing.T, f Factory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, store.Store)
+	}{
+		{"AllocateUnique", testAllocateUnique},
+		{"SeedRoundTrip", testSeedRoundTrip},
+		{"NotFound", testNotFound},
+		{"Release", testRelease},
+		{"Expiry", testExpiry},
+		{"Refresh", testRefresh},
+		{"Concurrency", testConcurrency},
+		{"Timed", testTimed},
+		{"Versioned", testVersioned},
+		{"Indexed", testIndexed},
+		{"Context", testContext},
+	}
+
+	for _, c := range tests {
+		fn := c.fn
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			s := f()
+			if c, ok := s.(io.Closer); ok {
+				defer c.Close()
+			}
+			s.SetTTL(60)
+			fn(t, s)
+		})
+	}
+}
+
+func allocate(t *testing.T, s store.Store) (id, seed string) {
+	t.Helper()
+	seed = genSeed()
+	id, err := s.Allocate(seed)
+	if err != nil {
+		t.Fatalf("cannot allocate: %s", err)
+	}
+	if id == "" {
+		t.Fatal("allocated an empty session id")
+	}
+
+	return
+}
+
+func testAllocateUnique(t *testing.T, s store.Store) {
+	ids := map[string]bool{}
+	for x := 0; x < 100; x++ {
+		id, _ := allocate(t, s)
+		if ids[id] {
+			t.Fatalf("session id %s is allocated twice", id)
+		}
+		ids[id] = true
+	}
+}
+
+func testSeedRoundTrip(t *testing.T, s store.Store) {
+	id, seed := allocate(t, s)
+
+	aSeed, data, err := s.Get(id)
+	if err != nil {
+		t.Fatalf("cannot get new session: %s", err)
+	}
+	if aSeed != seed {
+		t.Errorf("expected seed %s, got %s", seed, aSeed)
+	}
+	if data != "" {
+		t.Errorf("expected new session to have no data, got %s", data)
+	}
+
+	seed = genSeed()
+	for _, expect := range []string{"data", "", "多位元組\x00\n\"'`", "data"} {
+		if err = s.Set(id, seed, expect); err != nil {
+			t.Fatalf("cannot set %q: %s", expect, err)
+		}
+
+		aSeed, data, err = s.Get(id)
+		if err != nil {
+			t.Fatalf("cannot get %q: %s", expect, err)
+		}
+		if aSeed != seed || data != expect {
+			t.Errorf("expected (%s, %q), got (%s, %q)", seed, expect, aSeed, data)
+		}
+	}
+}
+
+func testNotFound(t *testing.T, s store.Store) {
+	id := "not-exist-" + genSeed()
+	if _, _, err := s.Get(id); err == nil {
+		t.Error("expected error getting non-exist session")
+	}
+	if err := s.Set(id, genSeed(), "data"); err == nil {
+		t.Error("expected error setting non-exist session")
+	}
+	if _, _, err := s.Get(id); err == nil {
+		t.Error("Set() MUST NOT create non-exist session")
+	}
+}
+
+func testRelease(t *testing.T, s store.Store) {
+	id, seed := allocate(t, s)
+	other, _ := allocate(t, s)
+
+	s.Release(id)
+	s.Release(id)                       // twice
+	s.Release("not-exist-" + genSeed()) // never fail
+
+	if _, _, err := s.Get(id); err == nil {
+		t.Error("expected error getting released session")
+	}
+	if err := s.Set(id, seed, "data"); err == nil {
+		t.Error("expected error setting released session")
+	}
+	if _, _, err := s.Get(other); err != nil {
+		t.Errorf("other session should not be released: %s", err)
+	}
+}
+
+func testExpiry(t *testing.T, s store.Store) {
+	s.SetTTL(1)
+	id, seed := allocate(t, s)
+
+	time.Sleep(2100 * time.Millisecond)
+	if _, _, err := s.Get(id); err == nil {
+		t.Error("expected error getting expired session")
+	}
+	if err := s.Set(id, seed, "data"); err == nil {
+		t.Error("expected error setting expired session")
+	}
+}
+
+func testRefresh(t *testing.T, s store.Store) {
+	s.SetTTL(2)
+	id, seed := allocate(t, s)
+	other, _ := allocate(t, s)
+
+	// 3 seconds in total, longer than ttl
+	for x := 0; x < 3; x++ {
+		time.Sleep(time.Second)
+		var err error
+		if x%2 == 0 {
+			_, _, err = s.Get(id)
+		} else {
+			err = s.Set(id, seed, strconv.Itoa(x))
+		}
+		if err != nil {
+			t.Fatalf("session should be refreshed by Get() and Set(): %s", err)
+		}
+	}
+
+	if _, _, err := s.Get(other); err == nil {
+		t.Error("session without access should be expired")
+	}
+}
+
+func testConcurrency(t *testing.T, s store.Store) {
+	wg := &sync.WaitGroup{}
+	for x := 0; x < 8; x++ {
+		wg.Add(1)
+		go func(x int) {
+			defer wg.Done()
+			for y := 0; y < 20; y++ {
+				seed := genSeed()
+				id, err := s.Allocate(seed)
+				if err != nil {
+					t.Errorf("cannot allocate: %s", err)
+					return
+				}
+
+				expect := strconv.Itoa(x) + "-" + strconv.Itoa(y)
+				if err = s.Set(id, seed, expect); err != nil {
+					t.Errorf("cannot set: %s", err)
+					return
+				}
+				aSeed, data, err := s.Get(id)
+				if err != nil {
+					t.Errorf("cannot get: %s", err)
+					return
+				}
+				if aSeed != seed || data != expect {
+					t.Errorf("expected (%s, %s), got (%s, %s)", seed, expect, aSeed, data)
+				}
+				s.Release(id)
+			}
+		}(x)
+	}
+	wg.Wait()
+}
+
+func testTimed(t *testing.T, s store.Store) {
+	ts, ok := s.(store.TimedStore)
+	if !ok {
+		t.Skip("store.TimedStore is not implemented")
+	}
+
+	seed := genSeed()
+	before := time.Now().Add(-time.Second)
+	id, err := ts.AllocateTimed(seed, 2, 60)
+	if err != nil {
+		t.Fatalf("cannot allocate: %s", err)
+	}
+
+	aSeed, _, info, err := ts.GetTimed(id)
+	if err != nil {
+		t.Fatalf("cannot get: %s", err)
+	}
+	if aSeed != seed {
+		t.Errorf("expected seed %s, got %s", seed, aSeed)
+	}
+	if info.TTL != 2 || info.MaxAge != 60 {
+		t.Errorf("expected ttl 2 and max age 60, got %+v", info)
+	}
+	if info.Created.Before(before) || info.Created.After(time.Now().Add(time.Second)) {
+		t.Errorf("unexpected creation time: %s", info.Created)
+	}
+
+	if err = ts.SetSessionTTL(id, 10); err != nil {
+		t.Fatalf("cannot set ttl: %s", err)
+	}
+	if _, _, info, _ = ts.GetTimed(id); info.TTL != 10 {
+		t.Errorf("expected ttl to be 10, got %d", info.TTL)
+	}
+	if err = ts.SetSessionTTL("not-exist-"+genSeed(), 10); err == nil {
+		t.Error("expected error setting ttl of non-exist session")
+	}
+
+	// max age
+	id, err = ts.AllocateTimed(seed, 10, 1)
+	if err != nil {
+		t.Fatalf("cannot allocate: %s", err)
+	}
+	time.Sleep(2100 * time.Millisecond)
+	if _, _, _, err = ts.GetTimed(id); err == nil {
+		t.Error("expected error getting session exceeding max age")
+	}
+}
+
+func testVersioned(t *testing.T, s store.Store) {
+	vs, ok := s.(store.VersionedStore)
+	if !ok {
+		t.Skip("store.VersionedStore is not implemented")
+	}
+
+	id, seed := allocate(t, s)
+	_, _, info, err := vs.GetTimed(id)
+	if err != nil {
+		t.Fatalf("cannot get: %s", err)
+	}
+
+	if err = vs.SetVersion(id, seed, "a", info.Version); err != nil {
+		t.Fatalf("cannot set: %s", err)
+	}
+	if err = vs.SetVersion(id, seed, "b", info.Version); err != store.ErrConflict {
+		t.Fatalf("expected store.ErrConflict, got %v", err)
+	}
+	if err = vs.Set(id, seed, "c"); err != nil {
+		t.Fatalf("cannot set: %s", err)
+	}
+
+	_, data, aInfo, _ := vs.GetTimed(id)
+	if data != "c" || aInfo.Version != info.Version+2 {
+		t.Errorf("expected c at version %d, got %s at version %d", info.Version+2, data, aInfo.Version)
+	}
+	if err = vs.SetVersion("not-exist-"+genSeed(), seed, "a", 0); err == nil || err == store.ErrConflict {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func testIndexed(t *testing.T, s store.Store) {
+	is, ok := s.(store.IndexedStore)
+	if !ok {
+		t.Skip("store.IndexedStore is not implemented")
+	}
+
+	owner, other := "owner-"+genSeed(), "other-"+genSeed()
+	a, _ := allocate(t, s)
+	b, _ := allocate(t, s)
+	c, _ := allocate(t, s)
+	d, _ := allocate(t, s)
+	for id, o := range map[string]string{a: owner, b: owner, c: other, d: other} {
+		if err := is.Bind(id, o, "127.0.0.1", "agent"); err != nil {
+			t.Fatalf("cannot bind: %s", err)
+		}
+	}
+	if err := is.Bind(d, owner, "127.0.0.2", "agent2"); err != nil {
+		t.Fatalf("cannot rebind: %s", err)
+	}
+	if err := is.Bind("not-exist-"+genSeed(), owner, "", ""); err == nil {
+		t.Error("expected error binding non-exist session")
+	}
+
+	list, err := is.List(owner)
+	if err != nil {
+		t.Fatalf("cannot list: %s", err)
+	}
+	found := map[string]store.Meta{}
+	for _, m := range list {
+		found[m.ID] = m
+	}
+	if len(found) != 3 || found[a].ID == "" || found[b].ID == "" || found[d].ID == "" {
+		t.Fatalf("expected %s, %s and %s, got %+v", a, b, d, list)
+	}
+	if m := found[d]; m.Owner != owner || m.IP != "127.0.0.2" || m.UserAgent != "agent2" {
+		t.Errorf("unexpected meta: %+v", m)
+	}
+
+	s.Release(a)
+	if list, _ = is.List(owner); len(list) != 2 {
+		t.Errorf("expected released session to be removed from list, got %+v", list)
+	}
+
+	if err = is.ReleaseAll(owner); err != nil {
+		t.Fatalf("cannot release: %s", err)
+	}
+	for _, id := range []string{b, d} {
+		if _, _, err = s.Get(id); err == nil {
+			t.Errorf("expected %s to be released", id)
+		}
+	}
+	if _, _, err = s.Get(c); err != nil {
+		t.Errorf("session of other owner should not be released: %s", err)
+	}
+}
+
+func testContext(t *testing.T, s store.Store) {
+	cs, ok := s.(store.ContextStore)
+	if !ok {
+		t.Skip("store.ContextStore is not implemented")
+	}
+
+	ctx := context.Background()
+	seed := genSeed()
+	id, err := cs.AllocateContext(ctx, seed, 60, 0)
+	if err != nil {
+		t.Fatalf("cannot allocate: %s", err)
+	}
+	if err = cs.SetContext(ctx, id, seed, "data"); err != nil {
+		t.Fatalf("cannot set: %s", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, _, err = cs.GetContext(canceled, id); err == nil {
+		t.Error("expected error with canceled context")
+	}
+	if err = cs.SetContext(canceled, id, seed, "canceled"); err == nil {
+		t.Error("expected error with canceled context")
+	}
+
+	_, data, _, err := cs.GetContext(ctx, id)
+	if err != nil {
+		t.Fatalf("cannot get: %s", err)
+	}
+	if data != "data" {
+		t.Errorf("expected data, got %s", data)
+	}
+}
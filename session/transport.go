@@ -0,0 +1,110 @@
+package session
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Transport defines how session id and seed are passed between server and
+// client
+type Transport interface {
+	// Read extracts session id and seed from request, returns empty string
+	// if not found.
+	Read(r *http.Request) (id, seed string)
+
+	// Write sends session id and seed to client. ttl < 0 means the session
+	// is destroyed, and client should forget it.
+	//
+	// r is the request which starts the session, it might be nil.
+	Write(w http.ResponseWriter, r *http.Request, id, seed string, ttl int)
+}
+
+// cookieTransport passes session id and seed in cookies, using cookie
+// settings in Manager
+type cookieTransport struct {
+	m *Manager
+}
+
+func (t cookieTransport) Read(r *http.Request) (id, seed string) {
+	if c, err := r.Cookie(t.m.Cookie.name(t.m.Key)); err == nil {
+		id = c.Value
+	}
+	if c, err := r.Cookie(t.m.Cookie.name(t.m.ChecksumKey)); err == nil {
+		seed = c.Value
+	}
+
+	return
+}
+
+func (t cookieTransport) Write(w http.ResponseWriter, r *http.Request, id, seed string, ttl int) {
+	secure := IsSecure(r)
+	http.SetCookie(w, t.m.makeCookie(t.m.Key, id, ttl, secure))
+	http.SetCookie(w, t.m.makeCookie(t.m.ChecksumKey, seed, ttl, secure))
+}
+
+// HeaderTransport passes session id and seed as a token in HTTP headers,
+// which is suitable for non-browser clients like mobile apps or CLI tools.
+//
+// Token is read from request header, and new token is written to response
+// header. Token is id + "." + seed, and empty token in response means the
+// session is destroyed.
+//
+// For browser based clients, remember to add ResponseHeader to
+// Access-Control-Expose-Headers.
+type HeaderTransport struct {
+	// Header is request header holding the token, default to "X-Session-Token"
+	Header string
+	// Scheme is the authentication scheme (like "Bearer") before the token
+	// in Header, empty string means the header holds only the token
+	Scheme string
+	// ResponseHeader is response header to send token, default to
+	// "X-Session-Token"
+	ResponseHeader string
+}
+
+// BearerTransport creates a HeaderTransport which reads token from
+// "Authorization: Bearer token" header, and sends token in response header
+// "X-Session-Token".
+func BearerTransport() *HeaderTransport {
+	return &HeaderTransport{
+		Header: "Authorization",
+		Scheme: "Bearer",
+	}
+}
+
+func (t *HeaderTransport) Read(r *http.Request) (id, seed string) {
+	h := t.Header
+	if h == "" {
+		h = "X-Session-Token"
+	}
+
+	token := strings.TrimSpace(r.Header.Get(h))
+	if t.Scheme != "" {
+		l := len(t.Scheme)
+		if len(token) <= l || !strings.EqualFold(token[:l], t.Scheme) || token[l] != ' ' {
+			return
+		}
+		token = strings.TrimSpace(token[l+1:])
+	}
+
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return
+	}
+
+	return token[:i], token[i+1:]
+}
+
+func (t *HeaderTransport) Write(w http.ResponseWriter, r *http.Request, id, seed string, ttl int) {
+	h := t.ResponseHeader
+	if h == "" {
+		h = "X-Session-Token"
+	}
+
+	if ttl < 0 {
+		w.Header().Set(h, "")
+		return
+	}
+
+	w.Header().Set(h, id+"."+seed)
+}
@@ -0,0 +1,70 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderTransportRead(t *testing.T) {
+	cases := []struct {
+		name   string
+		tr     *HeaderTransport
+		header string
+		value  string
+		id     string
+		seed   string
+	}{
+		{"bearer", BearerTransport(), "Authorization", "Bearer abc/+=.seed", "abc/+=", "seed"},
+		{"bearer case", BearerTransport(), "Authorization", "bearer abc.seed", "abc", "seed"},
+		{"bearer missing scheme", BearerTransport(), "Authorization", "abc.seed", "", ""},
+		{"bearer wrong scheme", BearerTransport(), "Authorization", "Basic abc.seed", "", ""},
+		{"custom", &HeaderTransport{Header: "X-Token"}, "X-Token", "abc.seed", "abc", "seed"},
+		{"default", &HeaderTransport{}, "X-Session-Token", "abc.seed", "abc", "seed"},
+		{"malformed", &HeaderTransport{}, "X-Session-Token", "abc", "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set(c.header, c.value)
+
+			id, seed := c.tr.Read(r)
+			if id != c.id || seed != c.seed {
+				t.Errorf("expected (%s, %s), got (%s, %s)", c.id, c.seed, id, seed)
+			}
+		})
+	}
+}
+
+func TestManagerWithBearerTransport(t *testing.T) {
+	m := &Manager{Transport: BearerTransport()}
+	w := httptest.NewRecorder()
+	sess, err := m.Start(w, httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("cannot start session: %s", err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) > 0 {
+		t.Errorf("expected no cookies, got %v", cookies)
+	}
+
+	token := w.Header().Get("X-Session-Token")
+	if token == "" {
+		t.Fatal("expected token in response header")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	actual, err := m.Start(w, r)
+	if err != nil {
+		t.Fatalf("cannot resume session: %s", err)
+	}
+	if actual.ID() != sess.ID() {
+		t.Errorf("expected session %s, got %s", sess.ID(), actual.ID())
+	}
+
+	actual.Destroy(w)
+	if v, ok := w.Header()["X-Session-Token"]; !ok || v[0] != "" {
+		t.Errorf("expected empty token after destroyed, got %v", v)
+	}
+}